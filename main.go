@@ -1,17 +1,31 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
+	"strings"
 
-	"github.com/vikstrous/mvpkg/internal/mvpkg"
+	"github.com/vikstrous/mvpkg/mvpkg"
 )
 
 type flagsStruct struct {
 	dryRun     bool
+	diff       bool
+	json       bool
 	recursive  bool
+	forward    bool
 	verbose    bool
+	name       string
+	alias      string
+	policy     string
+	qualifyDot bool
+	planOut    string
+	planIn     string
 	buildFlags arrayFlags
 }
 
@@ -19,16 +33,44 @@ func parseFlags() flagsStruct {
 	flags := flagsStruct{}
 	flag.BoolVar(&flags.verbose, "v", false, "verbose, print status while running")
 	flag.BoolVar(&flags.dryRun, "dry-run", false, "print planned actions without executing them")
+	flag.BoolVar(&flags.diff, "diff", false, "print the changes as a patch that git apply accepts instead of keeping them, they're made and rolled back")
+	flag.BoolVar(&flags.json, "json", false, "print a JSON description of the changes and the outcome once done")
+	flag.StringVar(&flags.planOut, "plan-out", "", "write the plan of the changes to a file instead of keeping them, they're made and rolled back")
+	flag.StringVar(&flags.planIn, "plan-in", "", "apply the plan in a file instead of running a command, as long as the files it was made from\n"+
+		"haven't changed since")
 	flag.BoolVar(&flags.recursive, "recursive", false, "recursively move all packages nested under the source package")
+	flag.StringVar(&flags.name, "name", "", "package name for the destination of a move or split, derived from the destination path by default")
+	flag.StringVar(&flags.alias, "alias-pattern", "", "pattern of the aliases given to imports whose name is already taken in a file,\n"+
+		"{name} is the package name and {n} a counter starting at 2 (default \"{name}{n}\")")
+	flag.StringVar(&flags.policy, "alias-policy", "", "what happens to the imports of a renamed package: rename references through unaliased imports,\n"+
+		"keep-name to alias imports with the old name instead, drop-redundant to also drop aliases equal to the new name\n"+
+		"or mirror to also rename aliases equal to the old name (default \"rename\")")
+	flag.BoolVar(&flags.qualifyDot, "qualify-dot-imports", false, "turn dot imports of the moved package into qualified imports")
+	flag.BoolVar(&flags.forward, "forward", false, "decl only: leave a type alias or forwarding function behind in the source package")
 	flag.Var(&flags.buildFlags, "build-flags", "build tags to use while parsing source packages, can be specified morethan once\n"+
 		"ex: -build-flags='-tags=foo bar'")
 
 	flag.Usage = func() {
 		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s <src> <dst>\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "       %s merge <src> <dst>\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "       %s decl <src>.<name> <dst>\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "       %s split -files <pattern> [-export] <src> <dst>\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "       %s undo\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "       %s -plan-in <file>\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "       %s extract-module <dir> [<module path>]\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "       %s merge-module <dir>\n", os.Args[0])
 		fmt.Fprintf(flag.CommandLine.Output(), "\n")
 		fmt.Fprintf(flag.CommandLine.Output(), "  mvpkg takes two positional arguments: a source and destination path\n")
-		fmt.Fprintf(flag.CommandLine.Output(), "  It works only within a single go module and only with go module support enabled.\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "  It works only with go module support enabled.\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "  The source and destination may be in different modules of the same repository.\n")
 		fmt.Fprintf(flag.CommandLine.Output(), "  The source and destination paths must be relative to the root of the go module\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "  merge merges the source package into the existing destination package\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "  decl moves a single declaration and its methods from the source package to the destination package\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "  split moves the files of the source package matching the pattern to a new destination package\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "  undo restores the files changed by the last move, as long as they haven't changed since\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "  extract-module turns a directory into a new nested module, optionally with a new module path\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "  merge-module merges the nested module in a directory back into the module containing it\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "  -plan-in applies a plan written by -plan-out\n")
 		fmt.Fprintf(flag.CommandLine.Output(), "\n")
 		flag.PrintDefaults()
 	}
@@ -40,29 +82,205 @@ func parseFlags() flagsStruct {
 func main() {
 	flags := parseFlags()
 
-	if flag.NArg() != 2 {
+	planIn := flag.NArg() == 0 && flags.planIn != ""
+	undo := flag.NArg() == 1 && flag.Arg(0) == "undo"
+	extractModule := (flag.NArg() == 2 || flag.NArg() == 3) && flag.Arg(0) == "extract-module"
+	mergeModule := flag.NArg() == 2 && flag.Arg(0) == "merge-module"
+	merge := flag.NArg() == 3 && flag.Arg(0) == "merge"
+	decl := flag.NArg() == 3 && flag.Arg(0) == "decl"
+	split := flag.NArg() > 0 && flag.Arg(0) == "split"
+
+	splitFlags := flag.NewFlagSet("split", flag.ExitOnError)
+	files := splitFlags.String("files", "", "pattern matching the names of the files to move, ex: -files='server_*.go'")
+	export := splitFlags.Bool("export", false, "export unexported identifiers referenced across the new package boundary")
+
+	if split {
+		_ = splitFlags.Parse(flag.Args()[1:])
+
+		if splitFlags.NArg() != 2 || *files == "" {
+			flag.Usage()
+			os.Exit(1)
+		}
+	}
+
+	if flag.NArg() != 2 && !planIn && !undo && !extractModule && !mergeModule && !merge && !decl && !split {
 		flag.Usage()
 		os.Exit(1)
 	}
 
+	if flags.diff && (flags.dryRun || undo) {
+		fmt.Println("-diff can't be used with -dry-run or undo")
+		os.Exit(1)
+	}
+
+	if flags.dryRun && undo {
+		// undo makes its changes right away, there is nothing to plan
+		fmt.Println("-dry-run can't be used with undo")
+		os.Exit(1)
+	}
+
+	if flags.json && (flags.diff || undo) {
+		fmt.Println("-json can't be used with -diff or undo")
+		os.Exit(1)
+	}
+
+	if flags.planIn != "" && flag.NArg() > 0 {
+		// the plan describes the command, a command given along with it would be silently run instead
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	if (flags.planOut != "" || flags.planIn != "") && (flags.diff || flags.dryRun || flags.json || undo || (flags.planOut != "" && flags.planIn != "")) {
+		fmt.Println("-plan-out and -plan-in can't be used together or with -diff, -dry-run, -json or undo")
+		os.Exit(1)
+	}
+
 	pwd, err := os.Getwd()
 	if err != nil {
 		fmt.Println(err.Error())
 		os.Exit(1)
 	}
 
-	printf := func(s string, args ...interface{}) {}
+	status := io.Writer(os.Stdout)
+	if flags.diff || flags.json {
+		// the patch or the JSON goes to stdout, so the status goes to stderr
+		status = os.Stderr
+	}
+
+	logger := mvpkg.LoggerFunc(func(s string, args ...interface{}) {})
 	if flags.verbose || flags.dryRun {
-		printf = func(s string, args ...interface{}) {
-			fmt.Printf(s, args...)
+		logger = func(s string, args ...interface{}) {
+			fmt.Fprintf(status, s, args...)
 		}
 	}
 
-	err = mvpkg.MvPkg(printf, pwd, flag.Arg(0), flag.Arg(1), []string(flags.buildFlags), flags.dryRun, flags.recursive)
+	// an interrupted command rolls back its changes
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	opts := mvpkg.Options{
+		Command:           mvpkg.CommandMove,
+		Pwd:               pwd,
+		Src:               flag.Arg(0),
+		Dst:               flag.Arg(1),
+		Name:              flags.name,
+		AliasPattern:      flags.alias,
+		AliasPolicy:       flags.policy,
+		BuildFlags:        []string(flags.buildFlags),
+		Recursive:         flags.recursive,
+		QualifyDotImports: flags.qualifyDot,
+		Forward:           flags.forward,
+		Logger:            logger,
+		DryRun:            flags.dryRun,
+	}
+
+	if flags.diff {
+		opts.Diff = os.Stdout
+	}
+
+	if flags.json {
+		opts.JSON = os.Stdout
+	}
+
+	switch {
+	case extractModule:
+		opts.Command, opts.Src, opts.Dst, opts.ModulePath = mvpkg.CommandExtractModule, flag.Arg(1), "", flag.Arg(2)
+	case merge:
+		opts.Command, opts.Src, opts.Dst = mvpkg.CommandMerge, flag.Arg(1), flag.Arg(2)
+	case decl:
+		opts.Src, opts.Decl = splitDecl(flag.Arg(1))
+		opts.Command, opts.Dst = mvpkg.CommandDecl, flag.Arg(2)
+	case split:
+		opts.Command, opts.Src, opts.Dst, opts.Files, opts.Export = mvpkg.CommandSplit, splitFlags.Arg(0), splitFlags.Arg(1), *files, *export
+	case mergeModule:
+		opts.Command, opts.Src, opts.Dst = mvpkg.CommandMergeModule, flag.Arg(1), ""
+	}
+
+	var warnings []string
+
+	switch {
+	case undo:
+		err = mvpkg.Undo(ctx, pwd, logger)
+	case planIn:
+		warnings, err = applyPlan(ctx, flags.planIn, pwd, logger)
+	case flags.planOut != "":
+		warnings, err = writePlan(ctx, opts, flags.planOut)
+	default:
+		var result *mvpkg.Result
+
+		result, err = mvpkg.Run(ctx, opts)
+		if result != nil {
+			warnings = result.Warnings
+		}
+	}
 	if err != nil {
-		fmt.Println(err.Error())
+		fmt.Fprintln(status, err.Error())
 		os.Exit(1)
 	}
+
+	// the warnings, like the aliases given to imports, are logged as they come with -v and -dry-run, but applying a
+	// plan only repeats the ones found when it was made
+	if planIn || (!flags.verbose && !flags.dryRun) {
+		for _, warning := range warnings {
+			fmt.Fprintf(os.Stderr, "warning: %s\n", warning)
+		}
+	}
+}
+
+// writePlan writes the plan of the command described by opts to filename and returns its warnings.
+func writePlan(ctx context.Context, opts mvpkg.Options, filename string) ([]string, error) {
+	plan, err := mvpkg.NewPlan(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode the plan: %w", err)
+	}
+
+	err = os.WriteFile(filename, append(data, '\n'), 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write the plan: %w", err)
+	}
+
+	return plan.Warnings, nil
+}
+
+// applyPlan applies the plan in filename to the repository containing pwd and returns its warnings.
+func applyPlan(ctx context.Context, filename, pwd string, logger mvpkg.Logger) ([]string, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the plan: %w", err)
+	}
+
+	var plan mvpkg.Plan
+
+	err = json.Unmarshal(data, &plan)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode the plan: %w", err)
+	}
+
+	plan.Options.Logger = logger
+
+	result, err := mvpkg.Apply(ctx, &plan, pwd)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Printf("moved %d, rewrote %d, created %d and removed %d files\n", len(result.Moved), len(result.Rewritten), len(result.Created), len(result.Removed))
+
+	return result.Warnings, nil
+}
+
+// splitDecl splits a reference to a declaration like path/to/pkg.Name into the package path and the name.
+func splitDecl(arg string) (string, string) {
+	i := strings.LastIndex(arg, ".")
+	if i <= strings.LastIndex(arg, "/") {
+		return arg, ""
+	}
+
+	return arg[:i], arg[i+1:]
 }
 
 type arrayFlags []string
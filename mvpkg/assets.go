@@ -0,0 +1,285 @@
+package mvpkg
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// Errors returned when the files embedded by a package can't follow it.
+var (
+	ErrAssetExists     = fmt.Errorf("destination already has a file with the same name")
+	ErrEmbedUnresolved = fmt.Errorf("embed pattern matches no files at the destination")
+)
+
+// packageAssets returns the files a package needs besides its source files: the files it embeds and its testdata
+// tree. The paths are relative to the package directory dir.
+func (p *pkgMover) packageAssets(pkgPath, dir string) ([]string, error) {
+	assets := map[string]struct{}{}
+
+	for _, filename := range p.collectFiles(pkgPath, func(pkg *packages.Package) [][]string {
+		return [][]string{pkg.EmbedFiles}
+	}) {
+		rel, err := filepath.Rel(dir, filename)
+		if err != nil {
+			return nil, fmt.Errorf("failed to make %s relative to %s: %w", filename, dir, err)
+		}
+
+		assets[rel] = struct{}{}
+	}
+
+	testdata := filepath.Join(dir, "testdata")
+
+	err := filepath.Walk(testdata, func(filename string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) && filename == testdata {
+			return filepath.SkipDir
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, filename)
+		if err != nil {
+			return fmt.Errorf("failed to make %s relative to %s: %w", filename, dir, err)
+		}
+
+		assets[rel] = struct{}{}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", testdata, err)
+	}
+
+	rels := make([]string, 0, len(assets))
+	for rel := range assets {
+		rels = append(rels, rel)
+	}
+
+	sort.Strings(rels)
+
+	return rels, nil
+}
+
+// moveAssets moves the embedded files and the testdata tree of the package in srcDir to dstDir, keeping their paths
+// relative to the package directory.
+func (p *pkgMover) moveAssets(pkgPath, srcDir, dstDir string) error {
+	assets, err := p.packageAssets(pkgPath, srcDir)
+	if err != nil {
+		return err
+	}
+
+	emptied := map[string]struct{}{}
+
+	for _, rel := range assets {
+		from, to := filepath.Join(srcDir, rel), filepath.Join(dstDir, rel)
+		if from == to {
+			continue
+		}
+
+		for dir := filepath.Dir(from); dir != srcDir; dir = filepath.Dir(dir) {
+			emptied[dir] = struct{}{}
+		}
+
+		_, exists, err := readIfExists(to)
+		if err != nil {
+			return err
+		}
+
+		if exists {
+			return fmt.Errorf("%w: %s", ErrAssetExists, to)
+		}
+
+		err = p.moveFile(from, to)
+		if err != nil {
+			return err
+		}
+	}
+
+	if p.dryRun {
+		return nil
+	}
+
+	return p.pruneEmptyDirs(emptied)
+}
+
+// moveDirFiles moves the files directly inside srcDir that are still there after its package moved, like
+// documentation and configuration, to dstDir.
+func (p *pkgMover) moveDirFiles(srcDir, dstDir string) error {
+	if srcDir == dstDir {
+		return nil
+	}
+
+	entries, err := os.ReadDir(srcDir)
+	if err != nil {
+		return fmt.Errorf("failed to list %s: %w", srcDir, err)
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		from, to := filepath.Join(srcDir, entry.Name()), filepath.Join(dstDir, entry.Name())
+		if _, ok := p.alreadyMovedFiles[from]; ok {
+			continue
+		}
+
+		_, exists, err := readIfExists(to)
+		if err != nil {
+			return err
+		}
+
+		if exists {
+			return fmt.Errorf("%w: %s", ErrAssetExists, to)
+		}
+
+		err = p.moveFile(from, to)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// moveSubdirs moves the given subdirectories of srcDir to dstDir as they are, file by file so that the undo journal
+// can check every one of them. The ones that are already gone, like a testdata directory moved with its package, are
+// skipped.
+func (p *pkgMover) moveSubdirs(srcDir, dstDir string, dirs []string) error {
+	if srcDir == dstDir {
+		return nil
+	}
+
+	emptied := map[string]struct{}{}
+
+	for _, dir := range dirs {
+		root := filepath.Join(srcDir, dir)
+
+		err := filepath.WalkDir(root, func(from string, entry fs.DirEntry, err error) error {
+			if os.IsNotExist(err) && from == root {
+				return filepath.SkipDir
+			}
+
+			if err != nil {
+				return err
+			}
+
+			rel, err := filepath.Rel(srcDir, from)
+			if err != nil {
+				return fmt.Errorf("failed to make %s relative to %s: %w", from, srcDir, err)
+			}
+
+			to := filepath.Join(dstDir, rel)
+
+			if entry.IsDir() {
+				emptied[from] = struct{}{}
+
+				if p.dryRun {
+					return nil
+				}
+
+				// empty directories move too
+				return p.journal.mkdirAll(to)
+			}
+
+			_, exists, err := readIfExists(to)
+			if err != nil {
+				return err
+			}
+
+			if exists {
+				return fmt.Errorf("%w: %s", ErrAssetExists, to)
+			}
+
+			return p.moveFile(from, to)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to move %s: %w", root, err)
+		}
+	}
+
+	if p.dryRun {
+		return nil
+	}
+
+	return p.pruneEmptyDirs(emptied)
+}
+
+// pruneEmptyDirs removes the directories that are left empty, children before their parents.
+func (p *pkgMover) pruneEmptyDirs(dirs map[string]struct{}) error {
+	sorted := make([]string, 0, len(dirs))
+	for dir := range dirs {
+		sorted = append(sorted, dir)
+	}
+
+	// a directory sorts before the directories inside it
+	sort.Sort(sort.Reverse(sort.StringSlice(sorted)))
+
+	for _, dir := range sorted {
+		entries, err := os.ReadDir(dir)
+		if os.IsNotExist(err) {
+			continue
+		}
+
+		if err != nil {
+			return fmt.Errorf("failed to list %s: %w", dir, err)
+		}
+
+		if len(entries) > 0 {
+			continue
+		}
+
+		p.log("removing empty directory %s\n", dir)
+
+		err = p.journal.removeDir(dir)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkEmbeds makes sure that every embed pattern of the package moved from srcDir still matches files in its new
+// directory.
+func (p *pkgMover) checkEmbeds(pkgPath, srcDir, dstDir string) error {
+	patterns := p.collectFiles(pkgPath, func(pkg *packages.Package) [][]string {
+		return [][]string{pkg.EmbedPatterns}
+	})
+
+	for _, pattern := range patterns {
+		pattern = filepath.FromSlash(strings.TrimPrefix(pattern, "all:"))
+
+		// the go command makes the patterns absolute
+		if filepath.IsAbs(pattern) {
+			rel, err := filepath.Rel(srcDir, pattern)
+			if err != nil {
+				return fmt.Errorf("failed to make %s relative to %s: %w", pattern, srcDir, err)
+			}
+
+			pattern = rel
+		}
+
+		matches, err := filepath.Glob(filepath.Join(dstDir, pattern))
+		if err != nil {
+			return fmt.Errorf("invalid embed pattern %s: %w", pattern, err)
+		}
+
+		if len(matches) == 0 {
+			return fmt.Errorf("%w: %s in %s", ErrEmbedUnresolved, pattern, dstDir)
+		}
+	}
+
+	return nil
+}
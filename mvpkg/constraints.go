@@ -0,0 +1,265 @@
+package mvpkg
+
+import (
+	"go/ast"
+	"go/build/constraint"
+	"go/parser"
+	"go/types"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// knownOS and knownArch are the values of GOOS and GOARCH that file names can be constrained to, as listed in
+// go/build/syslist.go.
+var (
+	knownOS = map[string]bool{
+		"aix": true, "android": true, "darwin": true, "dragonfly": true, "freebsd": true, "hurd": true, "illumos": true,
+		"ios": true, "js": true, "linux": true, "nacl": true, "netbsd": true, "openbsd": true, "plan9": true,
+		"solaris": true, "wasip1": true, "windows": true, "zos": true,
+	}
+	knownArch = map[string]bool{
+		"386": true, "amd64": true, "amd64p32": true, "arm": true, "armbe": true, "arm64": true, "arm64be": true,
+		"loong64": true, "mips": true, "mipsle": true, "mips64": true, "mips64le": true, "mips64p32": true,
+		"mips64p32le": true, "ppc": true, "ppc64": true, "ppc64le": true, "riscv": true, "riscv64": true, "s390": true,
+		"s390x": true, "sparc": true, "sparc64": true, "wasm": true,
+	}
+)
+
+// loadIgnoredFiles parses the Go files that the build constraints exclude from the current build configuration, so
+// that their imports can be rewritten too. They aren't type checked, so their references are only resolved
+// syntactically.
+func (p *pkgMover) loadIgnoredFiles() {
+	for _, pkg := range p.pkgs {
+		for _, filename := range pkg.IgnoredFiles {
+			if !strings.HasSuffix(filename, ".go") {
+				continue
+			}
+
+			if _, ok := p.files[filename]; ok {
+				continue
+			}
+
+			file, err := parser.ParseFile(p.fset, filename, nil, parser.ParseComments)
+			if err != nil {
+				p.log("skipping %s: %s\n", filename, err)
+
+				continue
+			}
+
+			p.files[filename] = &loadedFile{
+				file:        file,
+				info:        p.syntacticInfo(file, pkg.PkgPath),
+				pkgPath:     pkg.PkgPath,
+				constraints: buildConstraints(filename, file),
+			}
+		}
+	}
+}
+
+// syntacticInfo returns type information for a file of the package with the given path that wasn't type checked. The
+// identifiers that refer to the file's imports, which the parser leaves unresolved unlike local declarations shadowing
+// them, are recorded, along with the selectors through them and the package level identifiers, as referring to the
+// objects of the same name in the loaded packages. The objects are the ones declared for the current build
+// configuration, so a declaration of the file itself maps to its counterpart in another file, if there is one.
+func (p *pkgMover) syntacticInfo(file *ast.File, pkgPath string) *types.Info {
+	info := &types.Info{Uses: map[*ast.Ident]types.Object{}, Defs: map[*ast.Ident]types.Object{}}
+	pkgNames := map[string]*types.PkgName{}
+
+	for _, imp := range file.Imports {
+		importPath, err := importPathOf(imp.Path.Value)
+		if err != nil {
+			continue
+		}
+
+		name := p.pkgName(importPath)
+		if imp.Name != nil {
+			name = imp.Name.Name
+		}
+
+		if name == "_" || name == "." {
+			continue
+		}
+
+		imported := p.pkgTypes(importPath)
+		if imported == nil {
+			imported = types.NewPackage(importPath, p.pkgName(importPath))
+		}
+
+		pkgNames[name] = types.NewPkgName(imp.Pos(), nil, name, imported)
+	}
+
+	// a file excluded by the build constraints may be a program of its own, like a generator
+	var scope *types.Scope
+	if pkg := p.pkgTypes(pkgPath); pkg != nil && pkg.Name() == file.Name.Name {
+		scope = pkg.Scope()
+	}
+
+	skipped := map[*ast.Ident]bool{file.Name: true}
+
+	var visit func(n ast.Node) bool
+
+	visit = func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.SelectorExpr:
+			//nolint:staticcheck // the syntactic resolution is all there is without type checking
+			if ident, ok := n.X.(*ast.Ident); ok && ident.Obj == nil && pkgNames[ident.Name] != nil {
+				info.Uses[ident] = pkgNames[ident.Name]
+
+				if obj := pkgNames[ident.Name].Imported().Scope().Lookup(n.Sel.Name); obj != nil {
+					info.Uses[n.Sel] = obj
+				}
+
+				return false
+			}
+
+			// the selector of a field or method isn't a package level identifier
+			ast.Inspect(n.X, visit)
+
+			return false
+		case *ast.ImportSpec:
+			return false
+		case *ast.CompositeLit:
+			// the keys of a struct literal are field names
+			for _, elt := range n.Elts {
+				if kv, ok := elt.(*ast.KeyValueExpr); ok {
+					if key, ok := kv.Key.(*ast.Ident); ok {
+						skipped[key] = true
+					}
+				}
+			}
+		case *ast.FuncDecl:
+			if n.Recv != nil {
+				skipped[n.Name] = true
+			}
+		case *ast.Ident:
+			if scope == nil || skipped[n] {
+				return true
+			}
+
+			//nolint:staticcheck // the syntactic resolution is all there is without type checking
+			if n.Obj != nil && file.Scope.Lookup(n.Name) != n.Obj {
+				// a local declaration
+				return true
+			}
+
+			obj := scope.Lookup(n.Name)
+			if obj == nil {
+				return true
+			}
+
+			//nolint:staticcheck // the syntactic resolution is all there is without type checking
+			if n.Obj != nil && n.Obj.Decl != nil && declares(n.Obj.Decl, n) {
+				info.Defs[n] = obj
+			} else {
+				info.Uses[n] = obj
+			}
+		}
+
+		return true
+	}
+
+	ast.Inspect(file, visit)
+
+	return info
+}
+
+// declares returns true if the declaration node of an object declares it with the given identifier.
+func declares(decl interface{}, ident *ast.Ident) bool {
+	switch decl := decl.(type) {
+	case *ast.FuncDecl:
+		return decl.Name == ident
+	case *ast.TypeSpec:
+		return decl.Name == ident
+	case *ast.ValueSpec:
+		for _, name := range decl.Names {
+			if name == ident {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// pkgTypes returns the type checked package with the given path, if it was loaded.
+func (p *pkgMover) pkgTypes(pkgPath string) *types.Package {
+	for _, pkg := range p.pkgs {
+		if pkg.PkgPath == pkgPath && pkg.Types != nil {
+			return pkg.Types
+		}
+	}
+
+	return nil
+}
+
+// ignoredImporters returns the files excluded from the current build configuration that import the package with the
+// given path, sorted by name.
+func (p *pkgMover) ignoredImporters(pkgPath string) []string {
+	filenames := []string{}
+
+	for filename, loaded := range p.files {
+		if loaded.constraints != "" && imports(loaded.file, pkgPath) {
+			filenames = append(filenames, filename)
+		}
+	}
+
+	sort.Strings(filenames)
+
+	return filenames
+}
+
+// warnConstrained warns that a rewritten file is excluded from the current build configuration, so that the change is
+// checked in the configurations it's built for.
+func (p *pkgMover) warnConstrained(loaded *loadedFile, filename string) {
+	if loaded.constraints != "" {
+		p.warn("%s is only built for %s\n", p.reportPath(filename), loaded.constraints)
+	}
+}
+
+// buildConstraints describes the build configurations that include a file, from its //go:build line and the GOOS
+// and GOARCH suffixes of its name.
+func buildConstraints(filename string, file *ast.File) string {
+	constraints := []string{}
+
+	for _, group := range file.Comments {
+		if group.Pos() >= file.Package {
+			break
+		}
+
+		for _, comment := range group.List {
+			if !constraint.IsGoBuild(comment.Text) {
+				continue
+			}
+
+			expr, err := constraint.Parse(comment.Text)
+			if err == nil {
+				constraints = append(constraints, expr.String())
+			}
+		}
+	}
+
+	name := strings.TrimSuffix(strings.TrimSuffix(filepath.Base(filename), ".go"), "_test")
+	parts := strings.Split(name, "_")
+
+	switch {
+	case len(parts) > 2 && knownOS[parts[len(parts)-2]] && knownArch[parts[len(parts)-1]]:
+		constraints = append(constraints, parts[len(parts)-2]+" && "+parts[len(parts)-1])
+	case len(parts) > 1 && (knownOS[parts[len(parts)-1]] || knownArch[parts[len(parts)-1]]):
+		constraints = append(constraints, parts[len(parts)-1])
+	}
+
+	if len(constraints) == 0 {
+		return "other build configurations"
+	}
+
+	if len(constraints) > 1 {
+		for i, c := range constraints {
+			if strings.Contains(c, "||") {
+				constraints[i] = "(" + c + ")"
+			}
+		}
+	}
+
+	return strings.Join(constraints, " && ")
+}
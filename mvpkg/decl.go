@@ -0,0 +1,1108 @@
+package mvpkg
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// Errors returned by CommandDecl.
+var (
+	ErrDeclNotFound    = fmt.Errorf("declaration not found")
+	ErrDeclNotExported = fmt.Errorf("only exported declarations can be moved")
+	ErrDeclUnsupported = fmt.Errorf("declaration can't be moved on its own")
+	ErrDeclDeps        = fmt.Errorf("declaration refers to unexported declarations of its package")
+	ErrDeclCycle       = fmt.Errorf("moving the declaration would create an import cycle")
+	ErrDeclForward     = fmt.Errorf("can't leave a forwarding declaration behind")
+	ErrDeclFileExists  = fmt.Errorf("destination file already exists")
+)
+
+// declMove is a top level declaration being moved to another package, along with its methods.
+type declMove struct {
+	mPair movePair
+	name  string
+	// cuts are the declarations to move, in the order they appear in the source package
+	cuts []declCut
+	// dstName is the name of the destination package
+	dstName string
+	// dstFile is the new file the declarations are moved to
+	dstFile string
+	// forward is the source of the forwarding declaration to append to forwardFile, if any
+	forward     string
+	forwardFile string
+	// changed holds the files whose syntax trees were changed and need to be written back
+	changed map[string]struct{}
+	// emptied holds the source files left without any declarations, which are removed
+	emptied map[string]struct{}
+}
+
+// declCut is a declaration to move out of its file.
+type declCut struct {
+	filename string
+	decl     ast.Decl
+	// spec is set when only one spec of a grouped declaration is moved
+	spec ast.Spec
+}
+
+// runDecl runs CommandDecl: it moves the top level declaration opts.Decl from the package at opts.Src to the package at
+// opts.Dst, creating the destination package if needed. Methods and doc comments move with their declaration and every
+// reference in the loaded modules is requalified.
+// If opts.Forward is set, a type alias or forwarding function is left behind in the source package.
+func (p *pkgMover) runDecl(opts Options) (err error) {
+	err = p.setAliasPattern(opts.AliasPattern)
+	if err != nil {
+		return err
+	}
+
+	err = p.init(opts.Pwd)
+	if err != nil {
+		return fmt.Errorf("failed to initialize mover: %w", err)
+	}
+
+	mPairs := []movePair{{src: filepath.Clean(opts.Src), dst: filepath.Clean(opts.Dst)}}
+
+	err = p.resolvePairs(mPairs)
+	if err != nil {
+		return fmt.Errorf("failed to find modules: %w", err)
+	}
+
+	err = p.load(opts.BuildFlags)
+	if err != nil {
+		return fmt.Errorf("failed to initialize mover: %w", err)
+	}
+
+	d, err := p.findDecl(mPairs[0], opts.Decl)
+	if err != nil {
+		return err
+	}
+
+	p.log("Moving %s.%s to %s\n", d.mPair.srcPkgPath, opts.Decl, d.mPair.dstPkgPath)
+
+	p.recordPairs([]movePair{d.mPair})
+
+	// everything is prepared in memory first so that nothing is touched if the move isn't possible
+	text, err := p.declText(d)
+	if err != nil {
+		return err
+	}
+
+	err = p.requalifyDecl(d)
+	if err != nil {
+		return err
+	}
+
+	err = p.cutDecl(d, opts.Forward)
+	if err != nil {
+		return err
+	}
+
+	err = p.checkDeclCycles(d, text)
+	if err != nil {
+		return err
+	}
+
+	defer p.rollbackOnError(&err)
+
+	err = p.writeDecl(d, text)
+	if err != nil {
+		return err
+	}
+
+	err = p.fixGoMods()
+	if err != nil {
+		return fmt.Errorf("failed to update go.mod files: %w", err)
+	}
+
+	p.reportAliases()
+
+	return p.finish()
+}
+
+// findDecl finds the declaration with the given name in the source package, along with its methods.
+func (p *pkgMover) findDecl(mPair movePair, name string) (*declMove, error) {
+	if !ast.IsExported(name) {
+		return nil, fmt.Errorf("%w: %s", ErrDeclNotExported, name)
+	}
+
+	d := &declMove{mPair: mPair, name: name, changed: map[string]struct{}{}, emptied: map[string]struct{}{}}
+	found := false
+
+	for _, filename := range p.packageFiles(mPair.srcPkgPath) {
+		loaded, ok := p.files[filename]
+		if !ok || loaded.pkgPath != mPair.srcPkgPath || strings.HasSuffix(filename, "_test.go") {
+			continue
+		}
+
+		for _, decl := range loaded.file.Decls {
+			switch decl := decl.(type) {
+			case *ast.FuncDecl:
+				if decl.Recv == nil && decl.Name.Name == name {
+					found = true
+				}
+
+				if decl.Name.Name == name && decl.Recv == nil || decl.Recv != nil && receiverTypeName(decl.Recv) == name {
+					d.cuts = append(d.cuts, declCut{filename: filename, decl: decl})
+				}
+			case *ast.GenDecl:
+				cut, err := findSpec(decl, name)
+				if err != nil {
+					return nil, err
+				}
+
+				if cut != nil {
+					found = true
+					cut.filename = filename
+					d.cuts = append(d.cuts, *cut)
+				}
+			}
+		}
+	}
+
+	if !found {
+		return nil, fmt.Errorf("%w: %s in %s", ErrDeclNotFound, name, mPair.src)
+	}
+
+	d.dstName = packageNameFor(mPair.dstPkgPath)
+	if len(p.packageFiles(mPair.dstPkgPath)) > 0 {
+		d.dstName = p.pkgName(mPair.dstPkgPath)
+	}
+
+	d.dstFile = filepath.Join(p.moduleDir, mPair.dst, strings.ToLower(name)+".go")
+
+	_, exists, err := readIfExists(d.dstFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if exists {
+		return nil, fmt.Errorf("%w: %s", ErrDeclFileExists, d.dstFile)
+	}
+
+	return d, nil
+}
+
+// findSpec returns the cut for the spec declaring name in decl, if any.
+func findSpec(decl *ast.GenDecl, name string) (*declCut, error) {
+	for _, spec := range decl.Specs {
+		names := []*ast.Ident{}
+
+		switch spec := spec.(type) {
+		case *ast.TypeSpec:
+			names = append(names, spec.Name)
+		case *ast.ValueSpec:
+			names = spec.Names
+		}
+
+		for _, ident := range names {
+			if ident.Name != name {
+				continue
+			}
+
+			if len(names) > 1 {
+				return nil, fmt.Errorf("%w: %s is declared together with other names", ErrDeclUnsupported, name)
+			}
+
+			if len(decl.Specs) == 1 {
+				return &declCut{decl: decl}, nil
+			}
+
+			// constants in a group can depend on iota and on the expressions of the constants before them
+			if decl.Tok == token.CONST {
+				return nil, fmt.Errorf("%w: %s is part of a constant group", ErrDeclUnsupported, name)
+			}
+
+			return &declCut{decl: decl, spec: spec}, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// receiverTypeName returns the name of the type of a method receiver.
+func receiverTypeName(recv *ast.FieldList) string {
+	if len(recv.List) == 0 {
+		return ""
+	}
+
+	expr := recv.List[0].Type
+	for {
+		switch e := expr.(type) {
+		case *ast.StarExpr:
+			expr = e.X
+		case *ast.ParenExpr:
+			expr = e.X
+		case *ast.IndexExpr:
+			expr = e.X
+		case *ast.IndexListExpr:
+			expr = e.X
+		case *ast.Ident:
+			return e.Name
+		default:
+			return ""
+		}
+	}
+}
+
+// isMovedObject returns true if obj is the top level declaration being moved.
+func (d *declMove) isMovedObject(obj types.Object) bool {
+	return obj != nil && obj.Pkg() != nil && obj.Pkg().Path() == d.mPair.srcPkgPath &&
+		obj.Name() == d.name && obj.Parent() == obj.Pkg().Scope()
+}
+
+// isCut returns true if n is one of the declarations being moved.
+func (d *declMove) isCut(n ast.Node) bool {
+	for _, cut := range d.cuts {
+		if node, _, _ := cutNode(cut); node == n {
+			return true
+		}
+	}
+
+	return false
+}
+
+// textEdit replaces the bytes between start and end, which are offsets in the moved text, with text.
+type textEdit struct {
+	start int
+	end   int
+	text  string
+}
+
+// declText returns the source of the new file in the destination package. References to the destination package
+// become unqualified and references to other exported declarations of the source package become qualified.
+func (p *pkgMover) declText(d *declMove) (string, error) {
+	srcName := p.pkgName(d.mPair.srcPkgPath)
+	importSpecs := map[string]string{}
+	unexported := map[string]struct{}{}
+	chunks := []string{}
+
+	for _, cut := range d.cuts {
+		loaded := p.files[cut.filename]
+		tokFile := p.fset.File(loaded.file.Pos())
+
+		src, err := ioutil.ReadFile(cut.filename)
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s: %w", cut.filename, err)
+		}
+
+		node, _, prefix := cutNode(cut)
+		start, end := cutRange(cut)
+		startOffset := tokFile.Offset(start)
+		// a spec taken out of a group needs its keyword after its doc comment
+		edits := []textEdit{{start: tokFile.Offset(node.Pos()) - startOffset, end: tokFile.Offset(node.Pos()) - startOffset, text: prefix}}
+
+		ast.Inspect(node, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.SelectorExpr:
+				ident, ok := n.X.(*ast.Ident)
+				if ok && refersToPackage(loaded.info, ident, d.mPair.dstPkgPath) {
+					edits = append(edits, textEdit{start: tokFile.Offset(ident.Pos()) - startOffset, end: tokFile.Offset(n.Sel.Pos()) - startOffset})
+
+					return false
+				}
+			case *ast.Ident:
+				obj := loaded.info.Uses[n]
+				if pkgName, ok := obj.(*types.PkgName); ok {
+					importSpecs[pkgName.Imported().Path()] = n.Name
+
+					return true
+				}
+
+				if obj == nil || obj.Pkg() == nil || obj.Pkg().Path() != d.mPair.srcPkgPath || obj.Parent() != obj.Pkg().Scope() || d.isMovedObject(obj) {
+					return true
+				}
+
+				if !obj.Exported() {
+					unexported[obj.Name()] = struct{}{}
+
+					return true
+				}
+
+				importSpecs[d.mPair.srcPkgPath] = srcName
+				offset := tokFile.Offset(n.Pos()) - startOffset
+				edits = append(edits, textEdit{start: offset, end: offset, text: srcName + "."})
+			}
+
+			return true
+		})
+
+		chunks = append(chunks, applyEdits(string(src[startOffset:tokFile.Offset(end)]), edits))
+	}
+
+	if len(unexported) > 0 {
+		names := make([]string, 0, len(unexported))
+		for name := range unexported {
+			names = append(names, name)
+		}
+
+		sort.Strings(names)
+
+		return "", fmt.Errorf("%w: %s", ErrDeclDeps, strings.Join(names, ", "))
+	}
+
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "package %s\n\n", d.dstName)
+
+	if len(importSpecs) > 0 {
+		importPaths := make([]string, 0, len(importSpecs))
+		for importPath := range importSpecs {
+			importPaths = append(importPaths, importPath)
+		}
+
+		// standard library imports go first, in a group of their own
+		sort.Slice(importPaths, func(i, j int) bool {
+			if isStdImport(importPaths[i]) != isStdImport(importPaths[j]) {
+				return isStdImport(importPaths[i])
+			}
+
+			return importPaths[i] < importPaths[j]
+		})
+
+		buf.WriteString("import (\n")
+
+		for i, importPath := range importPaths {
+			if i > 0 && isStdImport(importPaths[i-1]) && !isStdImport(importPath) {
+				buf.WriteString("\n")
+			}
+
+			name := importSpecs[importPath]
+			if name == p.pkgName(importPath) {
+				name = ""
+			}
+
+			fmt.Fprintf(&buf, "\t%s %q\n", name, importPath)
+		}
+
+		buf.WriteString(")\n\n")
+	}
+
+	buf.WriteString(strings.Join(chunks, "\n\n"))
+	buf.WriteString("\n")
+
+	formatted, err := format.Source(buf.Bytes())
+	if err != nil {
+		return "", fmt.Errorf("failed to format moved declarations: %w", err)
+	}
+
+	return string(formatted), nil
+}
+
+// isStdImport returns true if importPath looks like the path of a standard library package.
+func isStdImport(importPath string) bool {
+	return !strings.Contains(strings.SplitN(importPath, "/", 2)[0], ".")
+}
+
+// cutNode returns the node to move for a cut along with its doc comment and the keyword it needs if it's a spec
+// taken out of a group.
+func cutNode(cut declCut) (ast.Node, *ast.CommentGroup, string) {
+	gen, _ := cut.decl.(*ast.GenDecl)
+
+	switch spec := cut.spec.(type) {
+	case *ast.TypeSpec:
+		return spec, spec.Doc, gen.Tok.String() + " "
+	case *ast.ValueSpec:
+		return spec, spec.Doc, gen.Tok.String() + " "
+	}
+
+	switch decl := cut.decl.(type) {
+	case *ast.FuncDecl:
+		return decl, decl.Doc, ""
+	default:
+		return gen, gen.Doc, ""
+	}
+}
+
+// cutRange returns the range of source text a cut covers, including its doc and line comments.
+func cutRange(cut declCut) (token.Pos, token.Pos) {
+	node, doc, _ := cutNode(cut)
+	start, end := node.Pos(), node.End()
+
+	if doc != nil {
+		start = doc.Pos()
+	}
+
+	spec := cut.spec
+	if gen, ok := cut.decl.(*ast.GenDecl); ok && spec == nil && !gen.Lparen.IsValid() {
+		spec = gen.Specs[0]
+	}
+
+	var comment *ast.CommentGroup
+
+	switch spec := spec.(type) {
+	case *ast.TypeSpec:
+		comment = spec.Comment
+	case *ast.ValueSpec:
+		comment = spec.Comment
+	}
+
+	if comment != nil && comment.End() > end {
+		end = comment.End()
+	}
+
+	return start, end
+}
+
+func applyEdits(text string, edits []textEdit) string {
+	sort.Slice(edits, func(i, j int) bool {
+		return edits[i].start > edits[j].start
+	})
+
+	for _, edit := range edits {
+		text = text[:edit.start] + edit.text + text[edit.end:]
+	}
+
+	return text
+}
+
+// requalifyDecl rewrites the references to the moved declaration in the source package, the destination package and
+// the importers of the source package, including the files excluded by the current build configuration. The syntax
+// trees are changed in memory only.
+func (p *pkgMover) requalifyDecl(d *declMove) error {
+	filenames := map[string]struct{}{}
+
+	for _, filename := range p.directoryFiles(d.mPair.srcPkgPath) {
+		filenames[filename] = struct{}{}
+	}
+
+	for _, pkg := range p.importers(d.mPair.srcPkgPath) {
+		for _, filename := range pkg.GoFiles {
+			filenames[filename] = struct{}{}
+		}
+	}
+
+	for _, filename := range p.ignoredImporters(d.mPair.srcPkgPath) {
+		filenames[filename] = struct{}{}
+	}
+
+	for filename := range filenames {
+		loaded, ok := p.files[filename]
+		if !ok {
+			continue
+		}
+
+		if p.requalifyDeclInFile(d, loaded) {
+			p.warnConstrained(loaded, filename)
+			d.changed[filename] = struct{}{}
+		}
+	}
+
+	return nil
+}
+
+// requalifyDeclInFile rewrites the references to the moved declaration in a file and returns true if there were any.
+func (p *pkgMover) requalifyDeclInFile(d *declMove, loaded *loadedFile) bool {
+	changed := false
+
+	if loaded.pkgPath == d.mPair.srcPkgPath {
+		changed = p.qualifyReferences(loaded, d.mPair.dstPkgPath, d.dstName, d.isMovedObject, d.isCut)
+	}
+
+	if p.requalifyReferences(loaded, d.mPair.srcPkgPath, d.mPair.dstPkgPath, d.dstName, d.isMovedObject, d.isCut) {
+		changed = true
+	}
+
+	if !changed {
+		return false
+	}
+
+	p.deleteUnusedImports(loaded, d.mPair.srcPkgPath)
+	ast.SortImports(p.fset, loaded.file)
+
+	return true
+}
+
+// qualifiedName returns the name the file refers to the package with the given path by at the given references,
+// importing the package with the default name, or an alias if a declaration would capture the references, if needed.
+func (p *pkgMover) qualifiedName(loaded *loadedFile, pkgPath, defaultName string, refs []*ast.Ident) string {
+	name, ok := p.importName(loaded.file, pkgPath)
+	if ok && name != "." {
+		return name
+	}
+
+	return p.addImport(loaded, pkgPath, defaultName, refs)
+}
+
+// qualifyReferences turns the unqualified references to the package level objects matched by moved into references
+// through the package with the given path, importing it if needed. Nodes matched by skip are left alone.
+// It returns true if there were any references.
+func (p *pkgMover) qualifyReferences(loaded *loadedFile, pkgPath, defaultName string, moved func(types.Object) bool, skip func(ast.Node) bool) bool {
+	qualified := map[*ast.Ident]struct{}{}
+
+	var refs []*ast.Ident
+
+	astutil.Apply(loaded.file, func(c *astutil.Cursor) bool {
+		if skip(c.Node()) {
+			return false
+		}
+
+		ident, ok := c.Node().(*ast.Ident)
+		if !ok || !moved(loaded.info.Uses[ident]) {
+			return true
+		}
+
+		// the selector of a field or method isn't an unqualified reference
+		if sel, ok := c.Parent().(*ast.SelectorExpr); ok && sel.Sel == ident {
+			return true
+		}
+
+		qualified[ident] = struct{}{}
+		refs = append(refs, ident)
+
+		return true
+	}, nil)
+
+	if len(refs) == 0 {
+		return false
+	}
+
+	// the name is only chosen once all the references are known, so that no local declaration captures any of them
+	name := p.qualifiedName(loaded, pkgPath, defaultName, refs)
+
+	astutil.Apply(loaded.file, func(c *astutil.Cursor) bool {
+		ident, ok := c.Node().(*ast.Ident)
+		if _, found := qualified[ident]; ok && found {
+			c.Replace(&ast.SelectorExpr{X: ast.NewIdent(name), Sel: ident})
+		}
+
+		return true
+	}, nil)
+
+	return true
+}
+
+// requalifyReferences turns the references through the package fromPkgPath to the objects matched by moved into
+// references through the package toPkgPath, or unqualified references if the file is part of that package.
+// Nodes matched by skip are left alone. It returns true if there were any references.
+func (p *pkgMover) requalifyReferences(loaded *loadedFile, fromPkgPath, toPkgPath, toName string, moved func(types.Object) bool, skip func(ast.Node) bool) bool {
+	sels := map[*ast.SelectorExpr]struct{}{}
+
+	var refs []*ast.Ident
+
+	astutil.Apply(loaded.file, func(c *astutil.Cursor) bool {
+		if skip(c.Node()) {
+			return false
+		}
+
+		sel, ok := c.Node().(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+
+		ident, ok := sel.X.(*ast.Ident)
+		if !ok || !refersToPackage(loaded.info, ident, fromPkgPath) || !moved(loaded.info.Uses[sel.Sel]) {
+			return true
+		}
+
+		sels[sel] = struct{}{}
+		refs = append(refs, ident)
+
+		return false
+	}, nil)
+
+	if len(refs) == 0 {
+		return false
+	}
+
+	if loaded.pkgPath == toPkgPath {
+		astutil.Apply(loaded.file, func(c *astutil.Cursor) bool {
+			sel, ok := c.Node().(*ast.SelectorExpr)
+			if _, found := sels[sel]; ok && found {
+				c.Replace(sel.Sel)
+			}
+
+			return true
+		}, nil)
+
+		return true
+	}
+
+	name := p.qualifiedName(loaded, toPkgPath, toName, refs)
+	for _, ident := range refs {
+		ident.Name = name
+	}
+
+	return true
+}
+
+// deleteUnusedImports removes the imports of the given packages that the file doesn't refer to anymore.
+// Identifiers without type information, added while rewriting the file, count as references by name.
+func (p *pkgMover) deleteUnusedImports(loaded *loadedFile, pkgPaths ...string) {
+	for _, pkgPath := range pkgPaths {
+		// deleting an import changes the list of imports
+		for _, imp := range append([]*ast.ImportSpec{}, loaded.file.Imports...) {
+			if imp.Path.Value != fmt.Sprintf("%q", pkgPath) {
+				continue
+			}
+
+			name := p.pkgName(pkgPath)
+			if imp.Name != nil {
+				name = imp.Name.Name
+			}
+
+			if name == "_" || name == "." || usesImport(loaded, pkgPath, name) {
+				continue
+			}
+
+			astutil.DeleteNamedImport(p.fset, loaded.file, nameOrEmpty(imp), pkgPath)
+		}
+	}
+}
+
+// usesImport returns true if the file refers to the import of pkgPath with the given name.
+func usesImport(loaded *loadedFile, pkgPath, name string) bool {
+	used := false
+
+	ast.Inspect(loaded.file, func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok || used {
+			return !used
+		}
+
+		ident, ok := sel.X.(*ast.Ident)
+		if !ok || ident.Name != name {
+			return true
+		}
+
+		if _, ok := loaded.info.Uses[ident]; !ok || refersToPackage(loaded.info, ident, pkgPath) {
+			used = true
+		}
+
+		return true
+	})
+
+	return used
+}
+
+func nameOrEmpty(imp *ast.ImportSpec) string {
+	if imp.Name == nil {
+		return ""
+	}
+
+	return imp.Name.Name
+}
+
+// cutDecl removes the moved declarations from the source files and leaves forwarding declarations behind if asked to.
+func (p *pkgMover) cutDecl(d *declMove, forward bool) error {
+	usedImports := map[string][]string{}
+
+	for _, cut := range d.cuts {
+		loaded := p.files[cut.filename]
+		start, end := cutRange(cut)
+
+		// the comments inside the moved declaration move with it
+		comments := []*ast.CommentGroup{}
+
+		for _, group := range loaded.file.Comments {
+			if group.Pos() < start || group.End() > end {
+				comments = append(comments, group)
+			}
+		}
+
+		loaded.file.Comments = comments
+
+		if cut.spec != nil {
+			gen := cut.decl.(*ast.GenDecl)
+			gen.Specs = removeSpec(gen.Specs, cut.spec)
+		} else {
+			loaded.file.Decls = removeDecl(loaded.file.Decls, cut.decl)
+		}
+
+		for _, imp := range loaded.file.Imports {
+			importPath, err := importPathOf(imp.Path.Value)
+			if err != nil {
+				return err
+			}
+
+			usedImports[cut.filename] = append(usedImports[cut.filename], importPath)
+		}
+
+		d.changed[cut.filename] = struct{}{}
+	}
+
+	if forward {
+		err := p.addForwardDecl(d)
+		if err != nil {
+			return err
+		}
+	}
+
+	for filename, pkgPaths := range usedImports {
+		loaded := p.files[filename]
+		p.deleteUnusedImports(loaded, pkgPaths...)
+
+		if !hasNonImportDecls(loaded.file) && filename != d.forwardFile {
+			d.emptied[filename] = struct{}{}
+		}
+	}
+
+	return nil
+}
+
+// addForwardDecl adds a type alias or forwarding function for the moved declaration to the file it was declared in.
+func (p *pkgMover) addForwardDecl(d *declMove) error {
+	var primary *declCut
+
+	for i, cut := range d.cuts {
+		if fn, ok := cut.decl.(*ast.FuncDecl); !ok || fn.Recv == nil {
+			primary = &d.cuts[i]
+		}
+	}
+
+	loaded := p.files[primary.filename]
+	dstName, ok := p.importName(loaded.file, d.mPair.dstPkgPath)
+
+	if !ok || dstName == "." {
+		dstName = p.addImport(loaded, d.mPair.dstPkgPath, d.dstName, nil)
+		ast.SortImports(p.fset, loaded.file)
+	}
+
+	var buf bytes.Buffer
+
+	node, doc, _ := cutNode(*primary)
+	if gen, ok := node.(*ast.GenDecl); ok {
+		node = gen.Specs[0]
+	}
+
+	// the forwarding declaration keeps the documentation of the moved one
+	if doc != nil {
+		for _, comment := range doc.List {
+			buf.WriteString(comment.Text + "\n")
+		}
+
+		buf.WriteString("//\n")
+	}
+
+	fmt.Fprintf(&buf, "// Deprecated: use %s.%s instead.\n", dstName, d.name)
+
+	switch node := node.(type) {
+	case *ast.FuncDecl:
+		call, err := p.forwardingFunc(node, dstName)
+		if err != nil {
+			return err
+		}
+
+		buf.WriteString(call)
+	case *ast.TypeSpec:
+		if node.TypeParams != nil {
+			return fmt.Errorf("%w: %s is generic", ErrDeclForward, d.name)
+		}
+
+		fmt.Fprintf(&buf, "type %s = %s.%s\n", d.name, dstName, d.name)
+	case *ast.ValueSpec:
+		if primary.decl.(*ast.GenDecl).Tok != token.CONST {
+			return fmt.Errorf("%w: %s is a variable", ErrDeclForward, d.name)
+		}
+
+		fmt.Fprintf(&buf, "const %s = %s.%s\n", d.name, dstName, d.name)
+	}
+
+	d.forward = buf.String()
+	d.forwardFile = primary.filename
+
+	return nil
+}
+
+// forwardingFunc returns the source of a function with the same signature as fn that calls the moved function.
+func (p *pkgMover) forwardingFunc(fn *ast.FuncDecl, dstName string) (string, error) {
+	args := []string{}
+
+	if fn.Type.Params != nil {
+		for i, field := range fn.Type.Params.List {
+			if len(field.Names) == 0 {
+				field.Names = []*ast.Ident{ast.NewIdent(fmt.Sprintf("p%d", i))}
+			}
+
+			for j, name := range field.Names {
+				if name.Name == "_" {
+					field.Names[j] = ast.NewIdent(fmt.Sprintf("p%d_%d", i, j))
+				}
+
+				arg := field.Names[j].Name
+				if _, ok := field.Type.(*ast.Ellipsis); ok {
+					arg += "..."
+				}
+
+				args = append(args, arg)
+			}
+		}
+	}
+
+	typeArgs := []string{}
+
+	if fn.Type.TypeParams != nil {
+		for _, field := range fn.Type.TypeParams.List {
+			for _, name := range field.Names {
+				typeArgs = append(typeArgs, name.Name)
+			}
+		}
+	}
+
+	var sig bytes.Buffer
+
+	err := printer.Fprint(&sig, p.fset, fn.Type)
+	if err != nil {
+		return "", fmt.Errorf("failed to print signature of %s: %w", fn.Name.Name, err)
+	}
+
+	call := dstName + "." + fn.Name.Name
+	if len(typeArgs) > 0 {
+		call += "[" + strings.Join(typeArgs, ", ") + "]"
+	}
+
+	call += "(" + strings.Join(args, ", ") + ")"
+	if fn.Type.Results != nil && len(fn.Type.Results.List) > 0 {
+		call = "return " + call
+	}
+
+	return fmt.Sprintf("func %s%s {\n\t%s\n}\n", fn.Name.Name, strings.TrimPrefix(sig.String(), "func"), call), nil
+}
+
+// checkDeclCycles makes sure that the imports between the source and destination packages after the move don't
+// create an import cycle, directly or through other packages.
+func (p *pkgMover) checkDeclCycles(d *declMove, text string) error {
+	src, dst := d.mPair.srcPkgPath, d.mPair.dstPkgPath
+
+	file, err := parser.ParseFile(p.fset, d.dstFile, text, parser.ImportsOnly)
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", d.dstFile, err)
+	}
+
+	srcFiles := []*ast.File{}
+	dstFiles := []*ast.File{file}
+
+	for filename, loaded := range p.files {
+		if _, ok := d.emptied[filename]; ok {
+			continue
+		}
+
+		switch loaded.pkgPath {
+		case src:
+			srcFiles = append(srcFiles, loaded.file)
+		case dst:
+			dstFiles = append(dstFiles, loaded.file)
+		}
+	}
+
+	srcImports, err := fileImports(srcFiles)
+	if err != nil {
+		return err
+	}
+
+	dstImports, err := fileImports(dstFiles)
+	if err != nil {
+		return err
+	}
+
+	if p.createsImportCycle(src, dst, srcImports, dstImports) {
+		return fmt.Errorf("%w between %s and %s", ErrDeclCycle, src, dst)
+	}
+
+	return nil
+}
+
+// createsImportCycle returns true if the packages src and dst import each other, directly or through other packages,
+// once their imports are replaced by srcImports and dstImports.
+func (p *pkgMover) createsImportCycle(src, dst string, srcImports, dstImports map[string]struct{}) bool {
+	graph := map[string]map[string]struct{}{}
+
+	for _, pkg := range p.pkgs {
+		// test variants and test binaries can't be imported, so they can't be part of a cycle
+		if pkg.ID != pkg.PkgPath {
+			continue
+		}
+
+		graph[pkg.PkgPath] = map[string]struct{}{}
+		for imp := range pkg.Imports {
+			graph[pkg.PkgPath][imp] = struct{}{}
+		}
+	}
+
+	graph[src] = srcImports
+	graph[dst] = dstImports
+
+	return reaches(graph, src, dst) && reaches(graph, dst, src)
+}
+
+// fileImports returns the paths of the packages imported by the given files. Tests in a package can create an import
+// cycle too, so the files of a package should include its tests.
+func fileImports(files []*ast.File) (map[string]struct{}, error) {
+	importPaths := map[string]struct{}{}
+
+	for _, file := range files {
+		for _, imp := range file.Imports {
+			importPath, err := importPathOf(imp.Path.Value)
+			if err != nil {
+				return nil, err
+			}
+
+			importPaths[importPath] = struct{}{}
+		}
+	}
+
+	return importPaths, nil
+}
+
+// reaches returns true if the package from imports the package to, directly or indirectly.
+func reaches(graph map[string]map[string]struct{}, from, to string) bool {
+	seen := map[string]struct{}{}
+	queue := []string{from}
+
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		for imp := range graph[current] {
+			if imp == to {
+				return true
+			}
+
+			if _, ok := seen[imp]; !ok {
+				seen[imp] = struct{}{}
+				queue = append(queue, imp)
+			}
+		}
+	}
+
+	return false
+}
+
+// writeDecl writes the new file in the destination package and every file changed by the move.
+func (p *pkgMover) writeDecl(d *declMove, text string) error {
+	dstDir := filepath.Dir(d.dstFile)
+
+	if p.dryRun {
+		p.log("would create directory %s\n", dstDir)
+	} else {
+		err := p.journal.mkdirAll(dstDir)
+		if err != nil {
+			return fmt.Errorf("error creating directory %s: %w", dstDir, err)
+		}
+	}
+
+	err := p.writeFile(d.dstFile, []byte(text))
+	if err != nil {
+		return err
+	}
+
+	// the new file has the moved declarations' imports, which the destination module may need requirements for
+	file, err := parser.ParseFile(p.fset, d.dstFile, text, parser.ImportsOnly)
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", d.dstFile, err)
+	}
+
+	srcModule, err := p.moduleFor(filepath.Join(p.moduleDir, d.mPair.src))
+	if err != nil {
+		return err
+	}
+
+	p.files[d.dstFile] = &loadedFile{file: file, info: &types.Info{}, pkgPath: d.mPair.dstPkgPath}
+	p.touchedFiles[d.dstFile] = srcModule
+
+	filenames := make([]string, 0, len(d.changed))
+	for filename := range d.changed {
+		filenames = append(filenames, filename)
+	}
+
+	sort.Strings(filenames)
+
+	for _, filename := range filenames {
+		switch _, emptied := d.emptied[filename]; {
+		case filename == d.forwardFile:
+			err = p.writeForwarded(filename, d.forward)
+		case emptied:
+			err = p.removeFile(filename)
+		default:
+			err = p.writeSyntax(filename)
+		}
+
+		if err != nil {
+			return fmt.Errorf("failed to update %s: %w", filename, err)
+		}
+	}
+
+	return nil
+}
+
+// writeForwarded writes filename with the forwarding declaration appended to it.
+func (p *pkgMover) writeForwarded(filename, forward string) error {
+	var buf bytes.Buffer
+
+	err := p.printConfig.Fprint(&buf, p.fset, p.files[filename].file)
+	if err != nil {
+		return fmt.Errorf("error formatting file %s: %w", filename, err)
+	}
+
+	buf.WriteString("\n" + forward)
+
+	formatted, err := format.Source(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("error formatting file %s: %w", filename, err)
+	}
+
+	err = p.touch(filename)
+	if err != nil {
+		return err
+	}
+
+	return p.writeFile(filename, formatted)
+}
+
+// removeFile removes filename through the journal, unless this is a dry run.
+func (p *pkgMover) removeFile(filename string) error {
+	if p.dryRun {
+		p.log("would remove %s\n", filename)
+
+		return nil
+	}
+
+	p.log("removing %s\n", filename)
+
+	return p.journal.remove(filename)
+}
+
+func hasNonImportDecls(file *ast.File) bool {
+	for _, decl := range file.Decls {
+		if gen, ok := decl.(*ast.GenDecl); ok && gen.Tok == token.IMPORT {
+			continue
+		}
+
+		return true
+	}
+
+	return false
+}
+
+func removeDecl(decls []ast.Decl, remove ast.Decl) []ast.Decl {
+	kept := []ast.Decl{}
+
+	for _, decl := range decls {
+		if decl != remove {
+			kept = append(kept, decl)
+		}
+	}
+
+	return kept
+}
+
+func removeSpec(specs []ast.Spec, remove ast.Spec) []ast.Spec {
+	kept := []ast.Spec{}
+
+	for _, spec := range specs {
+		if spec != remove {
+			kept = append(kept, spec)
+		}
+	}
+
+	return kept
+}
@@ -0,0 +1,470 @@
+package mvpkg
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ErrNotWritable is returned by diff and plan modes when a module can't be written to. They make the changes on disk
+// and roll them back once they're recorded, so they need the same access as the command itself.
+var ErrNotWritable = fmt.Errorf("module is not writable, the changes are made on disk and rolled back once recorded")
+
+// diffContext is the number of unchanged lines shown around the changes in a hunk, like git does by default.
+const diffContext = 3
+
+// fileChange is the net change made to a single file by a move, across every journal entry touching it.
+type fileChange struct {
+	// oldPath is where the file was before the move, it's empty if the move created it
+	oldPath string
+	// newPath is where the file is after the move, it's empty if the move removed it
+	newPath string
+	// oldData is the contents of the file before the move, only valid if oldKnown is set. A file that was only
+	// renamed keeps its contents, which are read from newPath.
+	oldData  []byte
+	oldKnown bool
+}
+
+// writeDiff writes the changes recorded in the journal as a patch that git apply accepts. Paths are relative to the
+// root of the repository, or of the main module outside of a repository. It must be called before the changes are
+// rolled back, since the new contents of the files are read from disk.
+func (p *pkgMover) writeDiff(w io.Writer) error {
+	root := p.repoRoot()
+
+	for _, c := range journalChanges(p.journal.entries) {
+		err := c.writePatch(w, root)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkWritable makes sure that every module taking part in the command can be written to, so that diff and plan modes
+// fail before changing anything rather than part way through.
+func (p *pkgMover) checkWritable() error {
+	for _, m := range p.sortedModules() {
+		f, err := os.CreateTemp(m.dir, ".mvpkg-*")
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrNotWritable, err)
+		}
+
+		err = f.Close()
+		if err == nil {
+			err = os.Remove(f.Name())
+		}
+
+		if err != nil {
+			return fmt.Errorf("failed to remove %s: %w", f.Name(), err)
+		}
+	}
+
+	return nil
+}
+
+// repoRoot returns the root of the repository containing the main module, or the root of the main module outside of a
+// repository.
+func (p *pkgMover) repoRoot() string {
+	if _, root, err := findGitDir(p.moduleDir); err == nil {
+		return root
+	}
+
+	return p.moduleDir
+}
+
+// journalChanges folds the journal entries into the net change made to each file, ordered by path. Directories are
+// left out, git doesn't track them.
+func journalChanges(entries []journalEntry) []*fileChange {
+	changes := []*fileChange{}
+	// current maps the paths the files are at so far to their changes
+	current := map[string]*fileChange{}
+
+	for _, e := range entries {
+		switch e.Op {
+		case opWrite:
+			c, ok := current[e.Path]
+			if !ok {
+				c = &fileChange{newPath: e.Path, oldData: e.Original, oldKnown: true}
+				if e.Existed {
+					c.oldPath = e.Path
+				}
+
+				changes = append(changes, c)
+				current[e.Path] = c
+			} else if !c.oldKnown {
+				// the file was renamed here and this is its first rewrite
+				c.oldData, c.oldKnown = e.Original, true
+			}
+		case opRename:
+			if c, ok := current[e.NewPath]; ok {
+				c.newPath = ""
+			} else if e.Existed {
+				changes = append(changes, &fileChange{oldPath: e.NewPath, oldData: e.Original, oldKnown: true})
+			}
+
+			c, ok := current[e.Path]
+			if !ok {
+				c = &fileChange{oldPath: e.Path}
+				changes = append(changes, c)
+			}
+
+			delete(current, e.Path)
+
+			c.newPath = e.NewPath
+			current[e.NewPath] = c
+		case opRemove:
+			c, ok := current[e.Path]
+			if !ok {
+				c = &fileChange{oldPath: e.Path, oldData: e.Original, oldKnown: true}
+				changes = append(changes, c)
+			}
+
+			delete(current, e.Path)
+
+			c.newPath = ""
+		case opMkdir, opRmdir:
+		}
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].sortKey() < changes[j].sortKey()
+	})
+
+	return changes
+}
+
+func (c *fileChange) sortKey() string {
+	if c.oldPath != "" {
+		return c.oldPath
+	}
+
+	return c.newPath
+}
+
+// writePatch writes the change as a git patch with paths relative to root. Nothing is written if the change has no
+// effect.
+func (c *fileChange) writePatch(w io.Writer, root string) error {
+	oldData, newData, err := c.contents()
+	if err != nil || c.unchanged(oldData, newData) {
+		return err
+	}
+
+	oldName, newName, err := c.patchNames(root)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "diff --git a/%s b/%s\n", oldName, newName)
+
+	switch {
+	case c.oldPath == "":
+		fmt.Fprintf(&buf, "new file mode %s\n", fileMode(c.newPath))
+	case c.newPath == "":
+		buf.WriteString("deleted file mode 100644\n")
+	case c.oldPath != c.newPath:
+		fmt.Fprintf(&buf, "rename from %s\nrename to %s\n", oldName, newName)
+	}
+
+	if !bytes.Equal(oldData, newData) {
+		oldLabel, newLabel := "a/"+oldName, "b/"+newName
+		if c.oldPath == "" {
+			oldLabel = "/dev/null"
+		}
+
+		if c.newPath == "" {
+			newLabel = "/dev/null"
+		}
+
+		if bytes.IndexByte(oldData, 0) >= 0 || bytes.IndexByte(newData, 0) >= 0 {
+			fmt.Fprintf(&buf, "Binary files %s and %s differ\n", oldLabel, newLabel)
+		} else {
+			fmt.Fprintf(&buf, "--- %s\n+++ %s\n", oldLabel, newLabel)
+			writeHunks(&buf, splitLines(oldData), splitLines(newData))
+		}
+	}
+
+	_, err = w.Write(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("error writing diff: %w", err)
+	}
+
+	return nil
+}
+
+// contents returns the contents of the file before and after the change. The new contents are read from disk, so
+// this must be called before the changes are rolled back.
+func (c *fileChange) contents() ([]byte, []byte, error) {
+	var newData []byte
+
+	if c.newPath != "" {
+		var err error
+
+		newData, err = os.ReadFile(c.newPath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error reading file %s: %w", c.newPath, err)
+		}
+	}
+
+	if !c.oldKnown {
+		return newData, newData, nil
+	}
+
+	return c.oldData, newData, nil
+}
+
+// unchanged reports whether the change has no effect, because the file was created and removed again or rewritten
+// with the same contents.
+func (c *fileChange) unchanged(oldData, newData []byte) bool {
+	return c.oldPath == c.newPath && bytes.Equal(oldData, newData)
+}
+
+// patchNames returns the old and new paths of the change relative to root, using the other one for a side that
+// doesn't exist, like git does.
+func (c *fileChange) patchNames(root string) (string, string, error) {
+	names := [2]string{}
+
+	for i, filePath := range []string{c.oldPath, c.newPath} {
+		if filePath == "" {
+			continue
+		}
+
+		var err error
+
+		names[i], err = relativePath(root, filePath)
+		if err != nil {
+			return "", "", err
+		}
+	}
+
+	if names[0] == "" {
+		names[0] = names[1]
+	}
+
+	if names[1] == "" {
+		names[1] = names[0]
+	}
+
+	return names[0], names[1], nil
+}
+
+// fileMode returns the git mode of the file, which is either executable or not.
+func fileMode(filename string) string {
+	info, err := os.Stat(filepath.Clean(filename))
+	if err == nil && info.Mode()&0o111 != 0 {
+		return "100755"
+	}
+
+	return "100644"
+}
+
+// splitLines splits data into lines, each keeping its line ending. The last line has none if data doesn't end with
+// a newline.
+func splitLines(data []byte) []string {
+	lines := strings.SplitAfter(string(data), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	return lines
+}
+
+// diffOp is a single line of an edit script: kept (' '), removed ('-') or added ('+'). aLine and bLine are the
+// positions of the line in the old and new lines, or where it would be in the side it isn't part of.
+type diffOp struct {
+	kind  byte
+	aLine int
+	bLine int
+}
+
+// diffLines returns the shortest edit script turning a into b, found with Myers' algorithm.
+func diffLines(a, b []string) []diffOp {
+	// the common prefix and suffix are kept as they are, which keeps the search small for typical edits
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	ops := []diffOp{}
+	for i := 0; i < prefix; i++ {
+		ops = append(ops, diffOp{kind: ' ', aLine: i, bLine: i})
+	}
+
+	for _, op := range myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]) {
+		op.aLine += prefix
+		op.bLine += prefix
+		ops = append(ops, op)
+	}
+
+	for i := 0; i < suffix; i++ {
+		ops = append(ops, diffOp{kind: ' ', aLine: len(a) - suffix + i, bLine: len(b) - suffix + i})
+	}
+
+	return ops
+}
+
+// myers returns the shortest edit script turning a into b.
+func myers(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+	offset := n + m + 1
+	v := make([]int, 2*offset+1)
+	// trace holds the furthest reaching paths before each step, to walk the edit script back from the end
+	trace := [][]int{}
+
+	for d := 0; d <= n+m; d++ {
+		trace = append(trace, append([]int(nil), v...))
+
+		for k := -d; k <= d; k += 2 {
+			x := v[offset+k-1] + 1
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			}
+
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+
+			v[offset+k] = x
+
+			if x >= n && y >= m {
+				return backtrack(trace, offset, n, m)
+			}
+		}
+	}
+
+	return nil
+}
+
+// backtrack walks the edit script found by myers back from the end of both sides.
+func backtrack(trace [][]int, offset, x, y int) []diffOp {
+	ops := []diffOp{}
+
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+
+		prevK := k - 1
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		}
+
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			x--
+			y--
+			ops = append(ops, diffOp{kind: ' ', aLine: x, bLine: y})
+		}
+
+		if d > 0 {
+			if x == prevX {
+				ops = append(ops, diffOp{kind: '+', aLine: x, bLine: prevY})
+			} else {
+				ops = append(ops, diffOp{kind: '-', aLine: prevX, bLine: y})
+			}
+		}
+
+		x, y = prevX, prevY
+	}
+
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+
+	return ops
+}
+
+// writeHunks writes the unified diff hunks turning a into b.
+func writeHunks(buf *bytes.Buffer, a, b []string) {
+	ops := diffLines(a, b)
+
+	for start := 0; start < len(ops); {
+		if ops[start].kind == ' ' {
+			start++
+
+			continue
+		}
+
+		// a hunk goes on as long as the unchanged lines between two changes fit in the context of both
+		end := start
+		for i := start; i < len(ops) && i-end <= 2*diffContext; i++ {
+			if ops[i].kind != ' ' {
+				end = i + 1
+			}
+		}
+
+		from := start - diffContext
+		if from < 0 {
+			from = 0
+		}
+
+		to := end + diffContext
+		if to > len(ops) {
+			to = len(ops)
+		}
+
+		writeHunk(buf, a, b, ops[from:to])
+
+		start = to
+	}
+}
+
+// writeHunk writes a single hunk made of the given operations.
+func writeHunk(buf *bytes.Buffer, a, b []string, ops []diffOp) {
+	aCount, bCount := 0, 0
+
+	for _, op := range ops {
+		if op.kind != '+' {
+			aCount++
+		}
+
+		if op.kind != '-' {
+			bCount++
+		}
+	}
+
+	fmt.Fprintf(buf, "@@ -%s +%s @@\n", hunkRange(ops[0].aLine, aCount), hunkRange(ops[0].bLine, bCount))
+
+	for _, op := range ops {
+		var line string
+		if op.kind == '+' {
+			line = b[op.bLine]
+		} else {
+			line = a[op.aLine]
+		}
+
+		buf.WriteByte(op.kind)
+		buf.WriteString(line)
+
+		if !strings.HasSuffix(line, "\n") {
+			buf.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+// hunkRange formats the range of a hunk on one side, starting at the 0-based line start. An empty range starts at
+// the line before it.
+func hunkRange(start, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", start)
+	case 1:
+		return fmt.Sprintf("%d", start+1)
+	default:
+		return fmt.Sprintf("%d,%d", start+1, count)
+	}
+}
@@ -0,0 +1,134 @@
+package mvpkg
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// ErrDotImportCollision is returned when a dot import of a moved package would collide with names of the importer.
+var ErrDotImportCollision = fmt.Errorf("dot import would collide with names of the importer, use -qualify-dot-imports to qualify it")
+
+// fixDotImport handles a dot import of the package moved from oldPkgPath to pkgPath, under the name to. The import
+// is turned into a qualified import if asked to. Otherwise it stays a dot import, as long as the names the package
+// declares after the move don't collide with the names the importer declares or gets from its other imports.
+// It returns the number of references that were qualified.
+func (p *pkgMover) fixDotImport(loaded *loadedFile, imp *ast.ImportSpec, oldPkgPath, pkgPath, to string) (int, error) {
+	if !p.qualifyDotImports {
+		return 0, p.checkDotImport(loaded, imp, oldPkgPath, pkgPath)
+	}
+
+	belongs := func(obj types.Object) bool {
+		return obj != nil && obj.Pkg() != nil && obj.Pkg().Path() == oldPkgPath && obj.Parent() == obj.Pkg().Scope()
+	}
+
+	// the qualified references may be captured by declarations in scope wherever the package was referred to
+	refs := dotRefs(loaded, belongs)
+	name := p.availableImportName(loaded, pkgPath, to, refs)
+
+	imp.Name = nil
+	aliasImport(loaded.file, pkgPath, to, name)
+
+	p.qualifyReferences(loaded, pkgPath, name, belongs, func(ast.Node) bool { return false })
+
+	p.log("qualified the dot import of %s in %s\n", pkgPath, p.getFilePath(p.fset.Position(loaded.file.Package).Filename))
+
+	return len(refs), nil
+}
+
+// dotRefs returns the unqualified references to the objects matched by belongs in the file.
+func dotRefs(loaded *loadedFile, belongs func(types.Object) bool) []*ast.Ident {
+	refs := []*ast.Ident{}
+
+	astutil.Apply(loaded.file, func(c *astutil.Cursor) bool {
+		ident, ok := c.Node().(*ast.Ident)
+		if !ok || !belongs(loaded.info.Uses[ident]) {
+			return true
+		}
+
+		// the selector of a field or method isn't an unqualified reference
+		if sel, ok := c.Parent().(*ast.SelectorExpr); ok && sel.Sel == ident {
+			return true
+		}
+
+		refs = append(refs, ident)
+
+		return true
+	}, nil)
+
+	return refs
+}
+
+// checkDotImport makes sure that the exported names of the package at pkgPath, which the file imports with a dot
+// import of its old path oldPkgPath, don't collide with the names declared by the importing package, the names of the
+// file's other imports and the names the file gets from its other dot imports. The package at pkgPath may already
+// exist when packages are merged, so the names of both packages are checked.
+func (p *pkgMover) checkDotImport(loaded *loadedFile, imp *ast.ImportSpec, oldPkgPath, pkgPath string) error {
+	fileScope := loaded.info.Scopes[loaded.file]
+	if fileScope == nil {
+		// there is nothing to check against without type information
+		return nil
+	}
+
+	names := p.exportedNames(oldPkgPath)
+	for name := range p.exportedNames(pkgPath) {
+		names[name] = struct{}{}
+	}
+
+	taken := p.importedNames(loaded, pkgPath)
+
+	for _, other := range loaded.file.Imports {
+		if other == imp || other.Name == nil || other.Name.Name != "." {
+			continue
+		}
+
+		if pkgName, ok := loaded.info.Implicits[other].(*types.PkgName); ok {
+			for _, name := range pkgName.Imported().Scope().Names() {
+				if ast.IsExported(name) {
+					taken[name] = struct{}{}
+				}
+			}
+		}
+	}
+
+	collisions := []string{}
+
+	for name := range names {
+		_, imported := taken[name]
+
+		if imported || fileScope.Parent().Lookup(name) != nil {
+			collisions = append(collisions, name)
+		}
+	}
+
+	if len(collisions) > 0 {
+		sort.Strings(collisions)
+
+		return fmt.Errorf("%w: %s in %s", ErrDotImportCollision, strings.Join(collisions, ", "), p.getFilePath(p.fset.Position(loaded.file.Package).Filename))
+	}
+
+	return nil
+}
+
+// exportedNames returns the exported package level names of the loaded package with the given path.
+func (p *pkgMover) exportedNames(pkgPath string) map[string]struct{} {
+	names := map[string]struct{}{}
+
+	for _, pkg := range p.pkgs {
+		if pkg.PkgPath != pkgPath || pkg.Types == nil {
+			continue
+		}
+
+		for _, name := range pkg.Types.Scope().Names() {
+			if ast.IsExported(name) {
+				names[name] = struct{}{}
+			}
+		}
+	}
+
+	return names
+}
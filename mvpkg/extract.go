@@ -0,0 +1,175 @@
+package mvpkg
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+
+	"golang.org/x/mod/modfile"
+)
+
+// ErrAlreadyModule is returned by CommandExtractModule for a directory that is already the root of a module.
+var ErrAlreadyModule = fmt.Errorf("directory is already the root of a module")
+
+// runExtractModule runs CommandExtractModule: it turns the directory opts.Src into a new nested module with the module
+// path opts.ModulePath. If it's empty, the import paths of the packages in the directory are kept the same.
+// The new module requires what its packages import from the parent module's requirements, and the modules that import
+// its packages get require and replace directives for it, or it's added to the workspace if there is one.
+func (p *pkgMover) runExtractModule(opts Options) (err error) {
+	dir := filepath.Clean(opts.Src)
+	modPath := opts.ModulePath
+
+	err = p.init(opts.Pwd)
+	if err != nil {
+		return fmt.Errorf("failed to initialize mover: %w", err)
+	}
+
+	modDir := filepath.Join(p.moduleDir, dir)
+
+	parent, err := p.moduleFor(modDir)
+	if err != nil {
+		return err
+	}
+
+	if parent.dir == filepath.ToSlash(modDir) {
+		return fmt.Errorf("%w: %s", ErrAlreadyModule, dir)
+	}
+
+	mPairs, err := p.findMovePairs(dir, dir, true)
+	if err != nil {
+		return fmt.Errorf("failed to find move pairs: %w", err)
+	}
+
+	err = p.resolvePairs(mPairs)
+	if err != nil {
+		return fmt.Errorf("failed to find modules: %w", err)
+	}
+
+	if modPath == "" {
+		modPath = mPairs[0].srcPkgPath
+	}
+
+	// the packages keep their directories, only their import paths change to be under the new module path
+	for i := range mPairs {
+		rel, err := filepath.Rel(dir, mPairs[i].src)
+		if err != nil {
+			return fmt.Errorf("failed to make %s relative to %s: %w", mPairs[i].src, dir, err)
+		}
+
+		mPairs[i].dstPkgPath = path.Join(modPath, filepath.ToSlash(rel))
+	}
+
+	err = p.load(opts.BuildFlags)
+	if err != nil {
+		return fmt.Errorf("failed to initialize mover: %w", err)
+	}
+
+	defer p.rollbackOnError(&err)
+
+	err = p.movePairs(mPairs)
+	if err != nil {
+		return err
+	}
+
+	err = p.createModule(parent, modDir, modPath)
+	if err != nil {
+		return fmt.Errorf("failed to create module %s: %w", modPath, err)
+	}
+
+	p.reportAliases()
+
+	if p.dryRun {
+		p.log("would add the requirements of %s and of the modules importing it\n", modPath)
+
+		return nil
+	}
+
+	err = p.fixGoMods()
+	if err != nil {
+		return fmt.Errorf("failed to update go.mod files: %w", err)
+	}
+
+	p.log("run go mod tidy in %s to add its indirect requirements\n", modDir)
+
+	return p.finish()
+}
+
+// createModule writes a go.mod file for a new module in dir, using the same go version as parent, and adds the
+// new module to the workspace if there is one.
+func (p *pkgMover) createModule(parent *goModule, dir, modPath string) error {
+	parentMod, err := p.readGoMod(parent)
+	if err != nil {
+		return err
+	}
+
+	modFile := &modfile.File{}
+
+	err = modFile.AddModuleStmt(modPath)
+	if err != nil {
+		return fmt.Errorf("invalid module path %s: %w", modPath, err)
+	}
+
+	if parentMod.Go != nil {
+		err = modFile.AddGoStmt(parentMod.Go.Version)
+		if err != nil {
+			return fmt.Errorf("failed to set go version: %w", err)
+		}
+	}
+
+	data, err := modFile.Format()
+	if err != nil {
+		return fmt.Errorf("failed to format go.mod: %w", err)
+	}
+
+	err = p.writeFile(filepath.Join(dir, "go.mod"), data)
+	if err != nil {
+		return err
+	}
+
+	if p.dryRun {
+		return nil
+	}
+
+	m, err := p.moduleFor(dir)
+	if err != nil {
+		return err
+	}
+
+	if p.workFile == "" {
+		return nil
+	}
+
+	m.inWorkspace = true
+
+	return p.addWorkspaceUse(dir)
+}
+
+// addWorkspaceUse adds a use directive for the module in dir to the workspace.
+func (p *pkgMover) addWorkspaceUse(dir string) error {
+	data, err := ioutil.ReadFile(p.workFile)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", p.workFile, err)
+	}
+
+	work, err := modfile.ParseWork(p.workFile, data, nil)
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", p.workFile, err)
+	}
+
+	use, err := filepath.Rel(filepath.Dir(p.workFile), dir)
+	if err != nil {
+		return fmt.Errorf("failed to make %s relative to %s: %w", dir, p.workFile, err)
+	}
+
+	use = localReplacement(use)
+
+	err = work.AddUse(use, "")
+	if err != nil {
+		return fmt.Errorf("failed to add %s to the workspace: %w", use, err)
+	}
+
+	work.Cleanup()
+
+	return p.writeFile(p.workFile, modfile.Format(work.Syntax))
+}
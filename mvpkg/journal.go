@@ -0,0 +1,250 @@
+package mvpkg
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+type journalOp string
+
+const (
+	opWrite  journalOp = "write"
+	opRename journalOp = "rename"
+	opMkdir  journalOp = "mkdir"
+	opRemove journalOp = "remove"
+	opRmdir  journalOp = "rmdir"
+)
+
+// journalEntry records a single filesystem mutation along with what's needed to undo it.
+type journalEntry struct {
+	Op      journalOp `json:"op"`
+	Path    string    `json:"path"`
+	NewPath string    `json:"new_path,omitempty"`
+	// Original holds the contents of the file that was overwritten, if any
+	Original []byte `json:"original,omitempty"`
+	Existed  bool   `json:"existed,omitempty"`
+	// Mode holds the permissions of the file that was overwritten or removed, if any
+	Mode os.FileMode `json:"mode,omitempty"`
+}
+
+// newFileMode is the mode of the files created by a move.
+const newFileMode = 0o644
+
+// journal performs filesystem mutations and records them so that they can be rolled back.
+type journal struct {
+	entries []journalEntry
+}
+
+// writeFile writes data to filename, remembering the previous contents of the file.
+func (j *journal) writeFile(filename string, data []byte) error {
+	original, existed, err := readIfExists(filename)
+	if err != nil {
+		return err
+	}
+
+	j.entries = append(j.entries, journalEntry{Op: opWrite, Path: filename, Original: original, Existed: existed, Mode: permOf(filename)})
+
+	err = ioutil.WriteFile(filename, data, newFileMode)
+	if err != nil {
+		return fmt.Errorf("error writing file %s: %w", filename, err)
+	}
+
+	return nil
+}
+
+// rename moves oldPath to newPath, remembering the contents of newPath if it gets overwritten.
+func (j *journal) rename(oldPath, newPath string) error {
+	original, existed, err := readIfExists(newPath)
+	if err != nil {
+		return err
+	}
+
+	mode := permOf(newPath)
+
+	err = os.Rename(oldPath, newPath)
+	if err != nil {
+		return fmt.Errorf("error moving %s to %s: %w", oldPath, newPath, err)
+	}
+
+	j.entries = append(j.entries, journalEntry{Op: opRename, Path: oldPath, NewPath: newPath, Original: original, Existed: existed, Mode: mode})
+
+	return nil
+}
+
+// remove deletes filename, remembering its contents.
+func (j *journal) remove(filename string) error {
+	original, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("error reading file %s: %w", filename, err)
+	}
+
+	mode := permOf(filename)
+
+	err = removeFile(filename)
+	if err != nil {
+		return err
+	}
+
+	j.entries = append(j.entries, journalEntry{Op: opRemove, Path: filename, Original: original, Existed: true, Mode: mode})
+
+	return nil
+}
+
+// mkdirAll creates dir and any missing parents, remembering which directories were created.
+func (j *journal) mkdirAll(dir string) error {
+	missing := []string{}
+
+	for d := filepath.Clean(dir); ; d = filepath.Dir(d) {
+		_, err := os.Stat(d)
+		if err == nil {
+			break
+		}
+
+		if !os.IsNotExist(err) {
+			return fmt.Errorf("error checking directory %s: %w", d, err)
+		}
+
+		missing = append(missing, d)
+
+		if filepath.Dir(d) == d {
+			break
+		}
+	}
+
+	// record parents first so that rollback removes children before their parents
+	for i := len(missing) - 1; i >= 0; i-- {
+		err := os.Mkdir(missing[i], 0o755)
+		if err != nil {
+			return fmt.Errorf("error creating directory %s: %w", missing[i], err)
+		}
+
+		j.entries = append(j.entries, journalEntry{Op: opMkdir, Path: missing[i]})
+	}
+
+	return nil
+}
+
+// removeDir removes the empty directory dir.
+func (j *journal) removeDir(dir string) error {
+	err := os.Remove(dir)
+	if err != nil {
+		return fmt.Errorf("error removing directory %s: %w", dir, err)
+	}
+
+	j.entries = append(j.entries, journalEntry{Op: opRmdir, Path: dir})
+
+	return nil
+}
+
+// rollback undoes all recorded mutations in reverse order. It keeps going after errors and returns all of them.
+func (j *journal) rollback() error {
+	var errs []error
+
+	for i := len(j.entries) - 1; i >= 0; i-- {
+		err := j.entries[i].undo()
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	j.entries = nil
+
+	return errors.Join(errs...)
+}
+
+func (e journalEntry) undo() error {
+	switch e.Op {
+	case opWrite:
+		if !e.Existed {
+			return removeFile(e.Path)
+		}
+
+		return writeBack(e.Path, e.Original, e.Mode)
+	case opRename:
+		err := os.Rename(e.NewPath, e.Path)
+		if err != nil {
+			return fmt.Errorf("error moving %s back to %s: %w", e.NewPath, e.Path, err)
+		}
+
+		if e.Existed {
+			return writeBack(e.NewPath, e.Original, e.Mode)
+		}
+
+		return nil
+	case opRemove:
+		return writeBack(e.Path, e.Original, e.Mode)
+	case opMkdir:
+		err := os.Remove(e.Path)
+		if err != nil {
+			return fmt.Errorf("error removing directory %s: %w", e.Path, err)
+		}
+
+		return nil
+	case opRmdir:
+		err := os.Mkdir(e.Path, 0o755)
+		if err != nil && !os.IsExist(err) {
+			return fmt.Errorf("error restoring directory %s: %w", e.Path, err)
+		}
+
+		return nil
+	default:
+		return fmt.Errorf("unknown journal operation %q", e.Op)
+	}
+}
+
+// writeBack restores the contents and the permissions of filename. Journals saved before the permissions were recorded
+// have no mode, the file gets the mode of new files then.
+func writeBack(filename string, data []byte, mode os.FileMode) error {
+	if mode == 0 {
+		mode = newFileMode
+	}
+
+	err := ioutil.WriteFile(filename, data, mode)
+	if err != nil {
+		return fmt.Errorf("error restoring file %s: %w", filename, err)
+	}
+
+	// the mode only applies to new files, a file that still exists keeps its own
+	err = os.Chmod(filename, mode)
+	if err != nil {
+		return fmt.Errorf("error restoring the mode of file %s: %w", filename, err)
+	}
+
+	return nil
+}
+
+// permOf returns the permissions of filename, or 0 if it doesn't exist.
+func permOf(filename string) os.FileMode {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return 0
+	}
+
+	return info.Mode().Perm()
+}
+
+func removeFile(filename string) error {
+	err := os.Remove(filename)
+	if err != nil {
+		return fmt.Errorf("error removing file %s: %w", filename, err)
+	}
+
+	return nil
+}
+
+// readIfExists returns the contents of filename and whether it exists.
+func readIfExists(filename string) ([]byte, bool, error) {
+	data, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+
+	if err != nil {
+		return nil, false, fmt.Errorf("error reading file %s: %w", filename, err)
+	}
+
+	return data, true, nil
+}
@@ -0,0 +1,402 @@
+package mvpkg
+
+import (
+	"fmt"
+	"go/version"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/semver"
+)
+
+// ErrNotModule is returned by CommandMergeModule for a directory that isn't the root of a nested module.
+var ErrNotModule = fmt.Errorf("directory is not the root of a nested module")
+
+// runMergeModule runs CommandMergeModule: it merges the nested module in the directory opts.Src back into the module
+// containing it. The nested go.mod and go.sum files are removed and their requirements merged into the parent module,
+// keeping the higher version when both require the same module. The go and toolchain lines of the parent module are
+// raised to the nested module's. Requirements on the nested module, replace directives pointing at it and its use
+// directive in the workspace are dropped, and imports of its packages are rewritten if the module path differs from
+// the path the packages get in the parent module.
+func (p *pkgMover) runMergeModule(opts Options) (err error) {
+	dir := filepath.Clean(opts.Src)
+
+	err = p.init(opts.Pwd)
+	if err != nil {
+		return fmt.Errorf("failed to initialize mover: %w", err)
+	}
+
+	nestedDir := filepath.Join(p.moduleDir, dir)
+
+	nested, err := p.moduleFor(nestedDir)
+	if err != nil {
+		return err
+	}
+
+	if nested.dir != filepath.ToSlash(nestedDir) {
+		return fmt.Errorf("%w: %s", ErrNotModule, dir)
+	}
+
+	parent, err := p.moduleFor(filepath.Dir(nestedDir))
+	if err != nil {
+		return fmt.Errorf("failed to find the module containing %s: %w", dir, err)
+	}
+
+	mPairs, err := p.findMovePairs(dir, dir, true)
+	if err != nil {
+		return fmt.Errorf("failed to find move pairs: %w", err)
+	}
+
+	err = p.resolvePairs(mPairs)
+	if err != nil {
+		return fmt.Errorf("failed to find modules: %w", err)
+	}
+
+	// the packages keep their directories, only their import paths change to be under the parent's module path
+	nestedRel, err := filepath.Rel(parent.dir, nested.dir)
+	if err != nil {
+		return fmt.Errorf("failed to make %s relative to %s: %w", nested.dir, parent.dir, err)
+	}
+
+	for i := range mPairs {
+		rel, err := filepath.Rel(dir, mPairs[i].src)
+		if err != nil {
+			return fmt.Errorf("failed to make %s relative to %s: %w", mPairs[i].src, dir, err)
+		}
+
+		mPairs[i].dstPkgPath = path.Join(parent.path, filepath.ToSlash(nestedRel), filepath.ToSlash(rel))
+	}
+
+	err = p.load(opts.BuildFlags)
+	if err != nil {
+		return fmt.Errorf("failed to initialize mover: %w", err)
+	}
+
+	defer p.rollbackOnError(&err)
+
+	err = p.movePairs(mPairs)
+	if err != nil {
+		return err
+	}
+
+	err = p.mergeModule(nested, parent)
+	if err != nil {
+		return fmt.Errorf("failed to merge module %s into %s: %w", nested.path, parent.path, err)
+	}
+
+	p.reportAliases()
+
+	if p.dryRun {
+		p.log("would add the requirements of the modules importing %s\n", parent.path)
+
+		return nil
+	}
+
+	err = p.fixGoMods()
+	if err != nil {
+		return fmt.Errorf("failed to update go.mod files: %w", err)
+	}
+
+	return p.finish()
+}
+
+// mergeModule merges the go.mod and go.sum files of nested into those of parent, removes them and drops every
+// reference to nested from the other modules and the workspace.
+func (p *pkgMover) mergeModule(nested, parent *goModule) error {
+	nestedMod, err := p.originalGoMod(nested)
+	if err != nil {
+		return err
+	}
+
+	parentMod, err := p.readGoMod(parent)
+	if err != nil {
+		return err
+	}
+
+	err = mergeRequirements(parentMod, nestedMod, nested, parent)
+	if err != nil {
+		return err
+	}
+
+	err = mergeGoVersions(parentMod, nestedMod)
+	if err != nil {
+		return err
+	}
+
+	err = p.writeGoMod(parent, parentMod)
+	if err != nil {
+		return err
+	}
+
+	err = p.mergeGoSums(nested, parent)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range p.sortedModules() {
+		if m == nested || m == parent {
+			continue
+		}
+
+		err = p.dropModuleReferences(m, nested.path)
+		if err != nil {
+			return err
+		}
+	}
+
+	if nested.inWorkspace {
+		err = p.dropWorkspaceUse(nested.dir)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, name := range []string{"go.mod", "go.sum"} {
+		filename := filepath.Join(nested.dir, name)
+
+		_, existed, err := readIfExists(filename)
+		if err != nil {
+			return err
+		}
+
+		if !existed {
+			continue
+		}
+
+		if p.dryRun {
+			p.log("would remove %s\n", filename)
+
+			continue
+		}
+
+		p.log("removing %s\n", filename)
+
+		err = p.journal.remove(filename)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !p.dryRun {
+		// packages in the nested directory are now provided by the parent module
+		delete(p.modules, nested.dir)
+	}
+
+	return nil
+}
+
+// mergeRequirements adds the requirements and replacements of nestedMod to parentMod. When both require the same
+// module, the higher version is kept. Requirements on and replacements of either module are dropped.
+func mergeRequirements(parentMod, nestedMod *modfile.File, nested, parent *goModule) error {
+	for _, req := range nestedMod.Require {
+		if req.Mod.Path == parent.path || req.Mod.Path == nested.path {
+			continue
+		}
+
+		version, indirect := req.Mod.Version, req.Indirect
+
+		existing := requireForImport(parentMod, req.Mod.Path)
+		if existing != nil && existing.Mod.Path == req.Mod.Path {
+			if semver.Compare(existing.Mod.Version, version) > 0 {
+				version = existing.Mod.Version
+			}
+
+			// the requirement is only indirect if neither module imports it directly
+			indirect = indirect && existing.Indirect
+
+			if version == existing.Mod.Version && indirect == existing.Indirect {
+				continue
+			}
+
+			err := parentMod.DropRequire(req.Mod.Path)
+			if err != nil {
+				return fmt.Errorf("failed to update requirement on %s: %w", req.Mod.Path, err)
+			}
+		}
+
+		parentMod.AddNewRequire(req.Mod.Path, version, indirect)
+	}
+
+	replaced := map[string]bool{}
+	for _, rep := range parentMod.Replace {
+		replaced[rep.Old.Path] = true
+	}
+
+	for _, rep := range nestedMod.Replace {
+		if replaced[rep.Old.Path] || rep.Old.Path == parent.path || rep.Old.Path == nested.path {
+			continue
+		}
+
+		newPath := rep.New.Path
+		// local replacements are relative to the directory of the go.mod file they're in
+		if modfile.IsDirectoryPath(newPath) && !filepath.IsAbs(newPath) {
+			rel, err := filepath.Rel(parent.dir, filepath.Join(nested.dir, newPath))
+			if err != nil {
+				return fmt.Errorf("failed to rebase replacement %s: %w", newPath, err)
+			}
+
+			newPath = localReplacement(rel)
+		}
+
+		err := parentMod.AddReplace(rep.Old.Path, rep.Old.Version, newPath, rep.New.Version)
+		if err != nil {
+			return fmt.Errorf("failed to add replacement of %s: %w", rep.Old.Path, err)
+		}
+	}
+
+	return dropRequirement(parentMod, nested.path)
+}
+
+// mergeGoVersions raises the go and toolchain lines of parentMod to those of nestedMod, the packages of the nested
+// module may need a newer version of the language than the parent module.
+func mergeGoVersions(parentMod, nestedMod *modfile.File) error {
+	if nestedMod.Go != nil && (parentMod.Go == nil || version.Compare("go"+nestedMod.Go.Version, "go"+parentMod.Go.Version) > 0) {
+		err := parentMod.AddGoStmt(nestedMod.Go.Version)
+		if err != nil {
+			return fmt.Errorf("failed to update the go version: %w", err)
+		}
+	}
+
+	if nestedMod.Toolchain != nil && (parentMod.Toolchain == nil || version.Compare(nestedMod.Toolchain.Name, parentMod.Toolchain.Name) > 0) {
+		err := parentMod.AddToolchainStmt(nestedMod.Toolchain.Name)
+		if err != nil {
+			return fmt.Errorf("failed to update the toolchain: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// dropModuleReferences removes the requirement on modPath and its replacements from the go.mod file of m.
+func (p *pkgMover) dropModuleReferences(m *goModule, modPath string) error {
+	modFile, err := p.readGoMod(m)
+	if err != nil {
+		return err
+	}
+
+	if !requires(modFile, modPath) && !replaces(modFile, modPath) {
+		return nil
+	}
+
+	err = dropRequirement(modFile, modPath)
+	if err != nil {
+		return err
+	}
+
+	return p.writeGoMod(m, modFile)
+}
+
+func dropRequirement(modFile *modfile.File, modPath string) error {
+	err := modFile.DropRequire(modPath)
+	if err != nil {
+		return fmt.Errorf("failed to drop requirement on %s: %w", modPath, err)
+	}
+
+	for _, rep := range modFile.Replace {
+		if rep.Old.Path != modPath {
+			continue
+		}
+
+		err = modFile.DropReplace(rep.Old.Path, rep.Old.Version)
+		if err != nil {
+			return fmt.Errorf("failed to drop replacement of %s: %w", modPath, err)
+		}
+	}
+
+	return nil
+}
+
+func requires(modFile *modfile.File, modPath string) bool {
+	for _, req := range modFile.Require {
+		if req.Mod.Path == modPath {
+			return true
+		}
+	}
+
+	return false
+}
+
+func replaces(modFile *modfile.File, modPath string) bool {
+	for _, rep := range modFile.Replace {
+		if rep.Old.Path == modPath {
+			return true
+		}
+	}
+
+	return false
+}
+
+// mergeGoSums adds the lines of the go.sum file of nested to the go.sum file of parent.
+func (p *pkgMover) mergeGoSums(nested, parent *goModule) error {
+	nestedSums, _, err := readIfExists(filepath.Join(nested.dir, "go.sum"))
+	if err != nil {
+		return err
+	}
+
+	if len(nestedSums) == 0 {
+		return nil
+	}
+
+	sumFile := filepath.Join(parent.dir, "go.sum")
+
+	parentSums, _, err := readIfExists(sumFile)
+	if err != nil {
+		return err
+	}
+
+	lines := map[string]struct{}{}
+
+	for _, sums := range [][]byte{parentSums, nestedSums} {
+		for _, line := range strings.Split(string(sums), "\n") {
+			if line != "" {
+				lines[line] = struct{}{}
+			}
+		}
+	}
+
+	merged := make([]string, 0, len(lines))
+	for line := range lines {
+		merged = append(merged, line)
+	}
+
+	sort.Strings(merged)
+
+	return p.writeFile(sumFile, []byte(strings.Join(merged, "\n")+"\n"))
+}
+
+// dropWorkspaceUse removes the use directive for the module in dir from the workspace.
+func (p *pkgMover) dropWorkspaceUse(dir string) error {
+	data, err := ioutil.ReadFile(p.workFile)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", p.workFile, err)
+	}
+
+	work, err := modfile.ParseWork(p.workFile, data, nil)
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", p.workFile, err)
+	}
+
+	for _, use := range work.Use {
+		useDir := filepath.FromSlash(use.Path)
+		if !filepath.IsAbs(useDir) {
+			useDir = filepath.Join(filepath.Dir(p.workFile), useDir)
+		}
+
+		if filepath.ToSlash(filepath.Clean(useDir)) != dir {
+			continue
+		}
+
+		err = work.DropUse(use.Path)
+		if err != nil {
+			return fmt.Errorf("failed to drop %s from the workspace: %w", use.Path, err)
+		}
+	}
+
+	work.Cleanup()
+
+	return p.writeFile(p.workFile, modfile.Format(work.Syntax))
+}
@@ -0,0 +1,502 @@
+package mvpkg
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/ast/astutil"
+	"golang.org/x/tools/go/packages"
+)
+
+// Errors returned when the destination doesn't suit the command, or when merging packages whose names collide.
+var (
+	ErrDstIsPackage   = fmt.Errorf("destination is already a package, use merge to merge packages")
+	ErrDstNotPackage  = fmt.Errorf("destination is not a package, use a regular move")
+	ErrDstFileExists  = fmt.Errorf("destination already has a file with the same name as a moved file")
+	ErrMergeCollision = fmt.Errorf("source and destination packages both declare the same names")
+	ErrMergeCapture   = fmt.Errorf("local declarations would capture references once they're unqualified")
+)
+
+// runMerge runs CommandMerge: it merges the package at opts.Src into the existing package at opts.Dst. Nothing is
+// changed if both packages declare the same top level names or contain files with the same names. Importers of both
+// packages end up with a single import of the destination package, and references between the two packages become
+// unqualified references within the merged package, as long as no local declaration would capture them.
+// Imports of the merged package and dot imports of it are handled as by runMove.
+func (p *pkgMover) runMerge(opts Options) (err error) {
+	err = p.setAliasPattern(opts.AliasPattern)
+	if err != nil {
+		return err
+	}
+
+	err = p.setAliasPolicy(opts.AliasPolicy)
+	if err != nil {
+		return err
+	}
+
+	p.qualifyDotImports = opts.QualifyDotImports
+	p.merge = true
+
+	err = p.init(opts.Pwd)
+	if err != nil {
+		return fmt.Errorf("failed to initialize mover: %w", err)
+	}
+
+	mPairs := []movePair{{src: filepath.Clean(opts.Src), dst: filepath.Clean(opts.Dst)}}
+
+	err = p.resolvePairs(mPairs)
+	if err != nil {
+		return fmt.Errorf("failed to find modules: %w", err)
+	}
+
+	err = p.load(opts.BuildFlags)
+	if err != nil {
+		return fmt.Errorf("failed to initialize mover: %w", err)
+	}
+
+	err = p.checkMerge(mPairs[0])
+	if err != nil {
+		return err
+	}
+
+	defer p.rollbackOnError(&err)
+
+	err = p.unqualifySelfReferences(mPairs[0])
+	if err != nil {
+		return fmt.Errorf("failed to fix references to %s in %s: %w", mPairs[0].dst, mPairs[0].src, err)
+	}
+
+	err = p.movePairs(mPairs)
+	if err != nil {
+		return err
+	}
+
+	err = p.fixGoMods()
+	if err != nil {
+		return fmt.Errorf("failed to update go.mod files: %w", err)
+	}
+
+	p.reportAliases()
+
+	return p.finish()
+}
+
+// checkDestinations makes sure that none of the destinations are existing packages, which would be merged into, and
+// that no moved file would overwrite a file already in a destination, like a Go file excluded by build constraints.
+func (p *pkgMover) checkDestinations(mPairs []movePair) error {
+	moved := map[string]struct{}{}
+
+	for _, mPair := range mPairs {
+		if len(p.packageFiles(mPair.dstPkgPath)) > 0 {
+			return fmt.Errorf("%w: %s", ErrDstIsPackage, mPair.dst)
+		}
+
+		for _, filename := range p.movedFiles(mPair) {
+			moved[filename] = struct{}{}
+		}
+	}
+
+	for _, mPair := range mPairs {
+		dstDir := filepath.Join(p.moduleDir, mPair.dst)
+
+		for _, filename := range p.movedFiles(mPair) {
+			newPath := filepath.Join(dstDir, filepath.Base(filename))
+			if _, ok := moved[newPath]; ok {
+				// the file there is moved away, or stays where it is
+				continue
+			}
+
+			_, err := os.Lstat(newPath)
+			if err == nil {
+				return fmt.Errorf("%w: %s", ErrDstFileExists, p.reportPath(newPath))
+			}
+
+			if !os.IsNotExist(err) {
+				return fmt.Errorf("failed to check %s: %w", newPath, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// movedFiles returns the files move moves for the pair: the files listed by the pair, or every file of the source
+// package, including the ones excluded by the build constraints.
+func (p *pkgMover) movedFiles(mPair movePair) []string {
+	if mPair.files != nil {
+		return mPair.files
+	}
+
+	return p.directoryFiles(mPair.srcPkgPath)
+}
+
+// checkMerge makes sure that the source package can be merged into the destination package without any
+// declarations or files colliding.
+func (p *pkgMover) checkMerge(mPair movePair) error {
+	dstFiles := p.packageFiles(mPair.dstPkgPath)
+	if len(dstFiles) == 0 {
+		return fmt.Errorf("%w: %s", ErrDstNotPackage, mPair.dst)
+	}
+
+	dstBases := map[string]string{}
+	dstNames := map[string]string{}
+
+	for _, filename := range dstFiles {
+		if loaded, ok := p.files[filename]; ok {
+			for _, name := range topLevelNames(loaded.file) {
+				dstNames[name] = filename
+			}
+		}
+	}
+
+	for _, filename := range p.directoryFiles(mPair.dstPkgPath) {
+		dstBases[filepath.Base(filename)] = filename
+	}
+
+	collisions := []string{}
+
+	for _, filename := range p.directoryFiles(mPair.srcPkgPath) {
+		if other, ok := dstBases[filepath.Base(filename)]; ok {
+			collisions = append(collisions, fmt.Sprintf("file %s exists as %s", filename, other))
+		}
+	}
+
+	for _, filename := range p.packageFiles(mPair.srcPkgPath) {
+		loaded, ok := p.files[filename]
+		if !ok {
+			continue
+		}
+
+		for _, name := range topLevelNames(loaded.file) {
+			if other, ok := dstNames[name]; ok {
+				collisions = append(collisions, fmt.Sprintf("%s declared in %s and %s", strings.TrimPrefix(name, "_test."), filename, other))
+			}
+		}
+	}
+
+	if len(collisions) > 0 {
+		sort.Strings(collisions)
+
+		return fmt.Errorf("%w: %s", ErrMergeCollision, strings.Join(collisions, ", "))
+	}
+
+	return p.checkMergeCaptures(mPair)
+}
+
+// checkMergeCaptures makes sure that the references between the two packages, which become unqualified references
+// within the merged package, aren't captured by local declarations with the same names.
+func (p *pkgMover) checkMergeCaptures(mPair movePair) error {
+	captures := []string{}
+
+	for filename, loaded := range p.files {
+		// the files whose references to a package are unqualified, see fixMergedImportsInFile
+		var pkgPath string
+
+		switch p.getPkgPath(loaded.pkgPath) {
+		case mPair.srcPkgPath:
+			pkgPath = mPair.dstPkgPath
+		case mPair.dstPkgPath:
+			pkgPath = mPair.srcPkgPath
+		default:
+			if name, ok := p.importName(loaded.file, mPair.dstPkgPath); !ok || name != "." {
+				continue
+			}
+
+			pkgPath = mPair.srcPkgPath
+		}
+
+		for _, name := range capturedNames(loaded, pkgPath) {
+			captures = append(captures, fmt.Sprintf("%s in %s", name, filename))
+		}
+	}
+
+	if len(captures) > 0 {
+		sort.Strings(captures)
+
+		return fmt.Errorf("%w: %s", ErrMergeCapture, strings.Join(captures, ", "))
+	}
+
+	return nil
+}
+
+// capturedNames returns the names of the references to the package with the given path in the file that would be
+// captured by a declaration of the file scope or a local scope if they were unqualified.
+func capturedNames(loaded *loadedFile, pkgPath string) []string {
+	sels := []*ast.Ident{}
+
+	ast.Inspect(loaded.file, func(node ast.Node) bool {
+		selExpr, ok := node.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+
+		ident, ok := selExpr.X.(*ast.Ident)
+		if ok && refersToPackage(loaded.info, ident, pkgPath) {
+			sels = append(sels, selExpr.Sel)
+		}
+
+		return true
+	})
+
+	captured := map[string]struct{}{}
+	fileScope := loaded.info.Scopes[loaded.file]
+
+	for _, sel := range sels {
+		if fileScope == nil {
+			// without type information, any identifier with the same name may be a local declaration
+			if declaresName(loaded.file, sel.Name, sels) {
+				captured[sel.Name] = struct{}{}
+			}
+
+			continue
+		}
+
+		scope := fileScope.Innermost(sel.Pos())
+		if scope == nil {
+			continue
+		}
+
+		// the package scope is where the unqualified reference should resolve
+		if found, obj := scope.LookupParent(sel.Name, sel.Pos()); obj != nil && found != fileScope.Parent() && found != types.Universe {
+			captured[sel.Name] = struct{}{}
+		}
+	}
+
+	names := make([]string, 0, len(captured))
+	for name := range captured {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// topLevelNames returns the names declared at the top level of a file. Names declared in external test packages are
+// prefixed with "_test." because they don't collide with names in the package under test.
+func topLevelNames(file *ast.File) []string {
+	prefix := ""
+	if strings.HasSuffix(file.Name.Name, "_test") {
+		prefix = "_test."
+	}
+
+	names := []string{}
+
+	add := func(ident *ast.Ident) {
+		if ident.Name != "_" {
+			names = append(names, prefix+ident.Name)
+		}
+	}
+
+	for _, decl := range file.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			// methods collide only if their types do and there can be any number of init functions
+			if decl.Recv == nil && decl.Name.Name != "init" {
+				add(decl.Name)
+			}
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					add(spec.Name)
+				case *ast.ValueSpec:
+					for _, name := range spec.Names {
+						add(name)
+					}
+				}
+			}
+		}
+	}
+
+	return names
+}
+
+// packageFiles returns the files of the package with the given path, including its tests.
+func (p *pkgMover) packageFiles(pkgPath string) []string {
+	return p.collectFiles(pkgPath, func(pkg *packages.Package) [][]string {
+		return [][]string{pkg.GoFiles}
+	})
+}
+
+// directoryFiles returns every file that belongs to the package with the given path, including its tests, the Go
+// files excluded by the current build constraints and the files in other languages, like assembly and C.
+func (p *pkgMover) directoryFiles(pkgPath string) []string {
+	return p.collectFiles(pkgPath, func(pkg *packages.Package) [][]string {
+		return [][]string{pkg.GoFiles, pkg.IgnoredFiles, pkg.OtherFiles}
+	})
+}
+
+// collectFiles returns the sorted files listed by filesOf for the package with the given path and its tests.
+func (p *pkgMover) collectFiles(pkgPath string, filesOf func(pkg *packages.Package) [][]string) []string {
+	// avoid duplication in case the package files show up more than once
+	files := map[string]struct{}{}
+
+	for _, pkg := range p.pkgs {
+		if p.getPkgPath(pkg.PkgPath) == pkgPath || p.getPkgPath(pkg.PkgPath) == pkgPath+"_test" {
+			for _, list := range filesOf(pkg) {
+				for _, file := range list {
+					files[file] = struct{}{}
+				}
+			}
+		}
+	}
+
+	filenames := make([]string, 0, len(files))
+	for filename := range files {
+		filenames = append(filenames, filename)
+	}
+
+	sort.Strings(filenames)
+
+	return filenames
+}
+
+// unqualifySelfReferences turns references to the destination package in the source package into unqualified
+// references, because both end up in the same package.
+func (p *pkgMover) unqualifySelfReferences(mPair movePair) error {
+	for _, filename := range p.packageFiles(mPair.srcPkgPath) {
+		loaded, ok := p.files[filename]
+		if !ok || loaded.pkgPath != mPair.srcPkgPath || !imports(loaded.file, mPair.dstPkgPath) {
+			continue
+		}
+
+		p.unqualify(loaded, mPair.dstPkgPath)
+
+		err := p.writeSyntax(filename)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// fixMergedImportsInFile handles the importers that need special treatment when merging packages: the destination
+// package itself and files that import both packages. It returns false if the file should be handled like the
+// importer of a moved package.
+func (p *pkgMover) fixMergedImportsInFile(mPair movePair, filename string) (bool, error) {
+	loaded := p.files[filename]
+
+	if p.getPkgPath(loaded.pkgPath) == mPair.dstPkgPath {
+		// the destination package refers to the source package's declarations directly once they're merged
+		p.unqualify(loaded, mPair.srcPkgPath)
+
+		return true, p.writeSyntax(filename)
+	}
+
+	name, ok := p.importName(loaded.file, mPair.dstPkgPath)
+	if !ok {
+		return false, nil
+	}
+
+	// the file already imports the destination package, so it can be used instead of the source package
+	if name == "." {
+		p.unqualify(loaded, mPair.srcPkgPath)
+
+		return true, p.writeSyntax(filename)
+	}
+
+	refs := []*ast.Ident{}
+
+	ast.Inspect(loaded.file, func(node ast.Node) bool {
+		selExpr, ok := node.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+
+		ident, ok := selExpr.X.(*ast.Ident)
+		if ok && refersToPackage(loaded.info, ident, mPair.srcPkgPath) {
+			refs = append(refs, ident)
+		}
+
+		return true
+	})
+
+	p.recordRewrite(p.getFilePath(filename), renameRefs(refs, name))
+
+	p.deleteImports(loaded.file, mPair.srcPkgPath)
+
+	return true, p.writeSyntax(filename)
+}
+
+// importName returns the name the given file refers to the package with the given path by.
+// It returns false if the file doesn't import the package or only imports it for its side effects.
+func (p *pkgMover) importName(file *ast.File, pkgPath string) (string, bool) {
+	for _, imp := range file.Imports {
+		if imp.Path.Value != fmt.Sprintf("%q", pkgPath) {
+			continue
+		}
+
+		if imp.Name == nil {
+			return p.pkgName(pkgPath), true
+		}
+
+		if imp.Name.Name != "_" {
+			return imp.Name.Name, true
+		}
+	}
+
+	return "", false
+}
+
+// pkgName returns the name of the loaded package with the given path.
+func (p *pkgMover) pkgName(pkgPath string) string {
+	for _, pkg := range p.pkgs {
+		if pkg.PkgPath == pkgPath {
+			return pkg.Name
+		}
+	}
+
+	return packageNameFor(pkgPath)
+}
+
+// unqualify removes the imports of the package with the given path from the file and turns the references to it
+// into unqualified references.
+func (p *pkgMover) unqualify(loaded *loadedFile, pkgPath string) {
+	astutil.Apply(loaded.file, nil, func(c *astutil.Cursor) bool {
+		selExpr, ok := c.Node().(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+
+		ident, ok := selExpr.X.(*ast.Ident)
+		if ok && refersToPackage(loaded.info, ident, pkgPath) {
+			c.Replace(selExpr.Sel)
+		}
+
+		return true
+	})
+
+	p.deleteImports(loaded.file, pkgPath)
+}
+
+func imports(file *ast.File, pkgPath string) bool {
+	for _, imp := range file.Imports {
+		if imp.Path.Value == fmt.Sprintf("%q", pkgPath) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// deleteImports removes every import of the package with the given path from the file.
+func (p *pkgMover) deleteImports(file *ast.File, pkgPath string) {
+	for _, imp := range file.Imports {
+		if imp.Path.Value != fmt.Sprintf("%q", pkgPath) {
+			continue
+		}
+
+		name := ""
+		if imp.Name != nil {
+			name = imp.Name.Name
+		}
+
+		astutil.DeleteNamedImport(p.fset, file, name, pkgPath)
+	}
+}
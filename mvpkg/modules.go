@@ -0,0 +1,503 @@
+package mvpkg
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+)
+
+// localModuleVersion is the version go mod tidy uses when requiring a module that is replaced by a local directory.
+const localModuleVersion = "v0.0.0-00010101000000-000000000000"
+
+// goModule is a go module taking part in a move.
+type goModule struct {
+	path string
+	dir  string
+	// inWorkspace is true if the module is used by the go.work file of the main module
+	inWorkspace bool
+	// original is the go.mod file of the module as it was before the move, read on first use
+	original *modfile.File
+}
+
+// moduleFor returns the module containing dir. dir doesn't need to exist yet.
+func (p *pkgMover) moduleFor(dir string) (*goModule, error) {
+	modPath, modDir, err := goModuleNameAndPath(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the module for %s: %w", dir, err)
+	}
+
+	m, ok := p.modules[modDir]
+	if !ok {
+		m = &goModule{path: modPath, dir: modDir}
+		p.modules[modDir] = m
+	}
+
+	return m, nil
+}
+
+// addWorkspaceModules registers every module used by the go.work file of the main module, if there is one,
+// so that importers in all of them are rewritten.
+func (p *pkgMover) addWorkspaceModules() error {
+	workFile, ok, err := goWorkPath(p.moduleDir)
+	if err != nil || !ok {
+		return err
+	}
+
+	data, err := ioutil.ReadFile(workFile)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", workFile, err)
+	}
+
+	work, err := modfile.ParseWork(workFile, data, nil)
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", workFile, err)
+	}
+
+	p.log("Using workspace %s\n", workFile)
+	p.workFile = workFile
+
+	for _, use := range work.Use {
+		dir := filepath.FromSlash(use.Path)
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(filepath.Dir(workFile), dir)
+		}
+
+		m, err := p.moduleFor(dir)
+		if err != nil {
+			return fmt.Errorf("failed to find module used by %s: %w", workFile, err)
+		}
+
+		m.inWorkspace = true
+	}
+
+	return nil
+}
+
+// env returns the environment to load packages with. The go command refuses to load packages in workspace mode
+// if GOFLAGS sets -mod to anything other than readonly or vendor, so -mod=mod is dropped when using a workspace.
+func (p *pkgMover) env() []string {
+	if p.workFile == "" {
+		return nil
+	}
+
+	env := os.Environ()
+
+	for i, kv := range env {
+		if !strings.HasPrefix(kv, "GOFLAGS=") {
+			continue
+		}
+
+		goflags := []string{}
+
+		for _, flag := range strings.Fields(strings.TrimPrefix(kv, "GOFLAGS=")) {
+			if flag != "-mod=mod" {
+				goflags = append(goflags, flag)
+			}
+		}
+
+		env[i] = "GOFLAGS=" + strings.Join(goflags, " ")
+	}
+
+	return env
+}
+
+// pkgPathFor returns the import path of the package at rel, a path relative to the root of the main module.
+// The package may belong to a different module than the main one.
+func (p *pkgMover) pkgPathFor(rel string) (string, error) {
+	dir := filepath.Join(p.moduleDir, rel)
+
+	m, err := p.moduleFor(dir)
+	if err != nil {
+		return "", err
+	}
+
+	modRel, err := filepath.Rel(m.dir, dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to make %s relative to module root %s: %w", dir, m.dir, err)
+	}
+
+	return path.Join(m.path, filepath.ToSlash(modRel)), nil
+}
+
+// touch records that filename was moved or rewritten, along with the module it was loaded from.
+func (p *pkgMover) touch(filename string) error {
+	if _, ok := p.touchedFiles[filename]; ok {
+		return nil
+	}
+
+	m, err := p.moduleFor(filepath.Dir(filename))
+	if err != nil {
+		return err
+	}
+
+	p.touchedFiles[filename] = m
+
+	return nil
+}
+
+// sortedModules returns the modules taking part in the move in a stable order.
+func (p *pkgMover) sortedModules() []*goModule {
+	mods := make([]*goModule, 0, len(p.modules))
+	for _, m := range p.modules {
+		mods = append(mods, m)
+	}
+
+	sort.Slice(mods, func(i, j int) bool {
+		return mods[i].dir < mods[j].dir
+	})
+
+	return mods
+}
+
+// localModuleForImport returns the module taking part in the move that provides the package with the given import path.
+func (p *pkgMover) localModuleForImport(importPath string) *goModule {
+	var found *goModule
+
+	for _, m := range p.modules {
+		if importPath != m.path && !strings.HasPrefix(importPath, m.path+"/") {
+			continue
+		}
+
+		// nested modules take precedence over their parents
+		if found == nil || len(m.path) > len(found.path) {
+			found = m
+		}
+	}
+
+	return found
+}
+
+// fixGoMods adds the requirements needed by files that changed modules during the move, or that started importing a
+// package from another module. Modules in the repository are required through replace directives pointing at their
+// directories, unless both modules are in the workspace, and other modules are required at the version the file's
+// original module required them at.
+func (p *pkgMover) fixGoMods() error {
+	if len(p.modules) < 2 {
+		return nil
+	}
+
+	// needs maps the directory of each module to the requirements it needs, keyed by module path
+	needs := map[string]map[string]*modfile.Require{}
+
+	filenames := make([]string, 0, len(p.touchedFiles))
+	for filename := range p.touchedFiles {
+		filenames = append(filenames, filename)
+	}
+
+	sort.Strings(filenames)
+
+	for _, filename := range filenames {
+		from := p.touchedFiles[filename]
+
+		to, err := p.moduleFor(filepath.Dir(p.getFilePath(filename)))
+		if err != nil {
+			return err
+		}
+
+		fromMod, err := p.originalGoMod(from)
+		if err != nil {
+			return err
+		}
+
+		if needs[to.dir] == nil {
+			needs[to.dir] = map[string]*modfile.Require{}
+		}
+
+		loaded, ok := p.files[filename]
+		if !ok {
+			continue
+		}
+
+		for _, imp := range loaded.file.Imports {
+			importPath, err := importPathOf(imp.Path.Value)
+			if err != nil {
+				return err
+			}
+
+			if local := p.localModuleForImport(importPath); local != nil {
+				// modules in the same workspace can import each other without any requirements
+				if local != to && !(local.inWorkspace && to.inWorkspace) {
+					needs[to.dir][local.path] = &modfile.Require{Mod: module.Version{Path: local.path, Version: localModuleVersion}}
+				}
+
+				continue
+			}
+
+			// anything that isn't required by the original module is either in the standard library or was already broken
+			if req := requireForImport(fromMod, importPath); req != nil {
+				needs[to.dir][req.Mod.Path] = req
+			}
+		}
+	}
+
+	for _, m := range p.sortedModules() {
+		if len(needs[m.dir]) == 0 {
+			continue
+		}
+
+		err := p.addRequirements(m, needs[m.dir])
+		if err != nil {
+			return fmt.Errorf("failed to update go.mod of %s: %w", m.path, err)
+		}
+	}
+
+	return nil
+}
+
+// addRequirements adds the requirements m doesn't have yet to its go.mod file.
+func (p *pkgMover) addRequirements(m *goModule, reqs map[string]*modfile.Require) error {
+	modFile, err := p.readGoMod(m)
+	if err != nil {
+		return err
+	}
+
+	required := map[string]bool{}
+	for _, req := range modFile.Require {
+		required[req.Mod.Path] = true
+	}
+
+	modPaths := make([]string, 0, len(reqs))
+	for modPath := range reqs {
+		modPaths = append(modPaths, modPath)
+	}
+
+	sort.Strings(modPaths)
+
+	sums := []string{}
+	changed := false
+
+	for _, modPath := range modPaths {
+		if required[modPath] {
+			continue
+		}
+
+		req := reqs[modPath]
+
+		p.log("adding requirement on %s %s to %s\n", req.Mod.Path, req.Mod.Version, m.path)
+
+		err = modFile.AddRequire(req.Mod.Path, req.Mod.Version)
+		if err != nil {
+			return fmt.Errorf("failed to add requirement on %s: %w", req.Mod.Path, err)
+		}
+
+		changed = true
+
+		local := p.localModuleForImport(modPath)
+		if local == nil || local.path != modPath {
+			sums = append(sums, req.Mod.Path+" "+req.Mod.Version)
+
+			continue
+		}
+
+		replacement, err := filepath.Rel(m.dir, local.dir)
+		if err != nil {
+			return fmt.Errorf("failed to make %s relative to %s: %w", local.dir, m.dir, err)
+		}
+
+		err = modFile.AddReplace(modPath, "", localReplacement(replacement), "")
+		if err != nil {
+			return fmt.Errorf("failed to add replacement of %s: %w", modPath, err)
+		}
+	}
+
+	if !changed {
+		return nil
+	}
+
+	err = p.writeGoMod(m, modFile)
+	if err != nil {
+		return err
+	}
+
+	return p.copyGoSums(m, sums)
+}
+
+// writeGoMod formats modFile and writes it as the go.mod file of m.
+func (p *pkgMover) writeGoMod(m *goModule, modFile *modfile.File) error {
+	modFile.SortBlocks()
+	modFile.Cleanup()
+
+	data, err := modFile.Format()
+	if err != nil {
+		return fmt.Errorf("failed to format go.mod: %w", err)
+	}
+
+	return p.writeFile(filepath.Join(m.dir, "go.mod"), data)
+}
+
+// copyGoSums copies the go.sum lines of the given module versions from the go.sum files of the other modules in the
+// move into the go.sum of m, so that the new requirements can be verified without running go mod tidy.
+func (p *pkgMover) copyGoSums(m *goModule, modVersions []string) error {
+	if len(modVersions) == 0 {
+		return nil
+	}
+
+	sumFile := filepath.Join(m.dir, "go.sum")
+
+	existing, _, err := readIfExists(sumFile)
+	if err != nil {
+		return err
+	}
+
+	have := map[string]bool{}
+	for _, line := range strings.Split(string(existing), "\n") {
+		have[line] = true
+	}
+
+	added := []string{}
+
+	for _, other := range p.sortedModules() {
+		if other == m {
+			continue
+		}
+
+		data, _, err := readIfExists(filepath.Join(other.dir, "go.sum"))
+		if err != nil {
+			return err
+		}
+
+		for _, line := range strings.Split(string(data), "\n") {
+			if have[line] || !hasAnyPrefix(line, modVersions) {
+				continue
+			}
+
+			have[line] = true
+			added = append(added, line)
+		}
+	}
+
+	if len(added) == 0 {
+		return nil
+	}
+
+	lines := append(strings.Split(strings.TrimSuffix(string(existing), "\n"), "\n"), added...)
+	if len(existing) == 0 {
+		lines = added
+	}
+
+	sort.Strings(lines)
+
+	return p.writeFile(sumFile, []byte(strings.Join(lines, "\n")+"\n"))
+}
+
+// writeFile writes data to filename through the journal, unless this is a dry run.
+func (p *pkgMover) writeFile(filename string, data []byte) error {
+	p.recordRewrite(filename, 0)
+
+	if p.dryRun {
+		p.log("would rewrite %s\n", filename)
+
+		return nil
+	}
+
+	p.log("rewriting %s\n", filename)
+
+	return p.journal.writeFile(filename, data)
+}
+
+// moveFile moves the file from to the path to through the journal, creating the directories it needs, unless this is
+// a dry run.
+func (p *pkgMover) moveFile(from, to string) error {
+	p.report.Moves = append(p.report.Moves, reportMove{From: p.reportPath(from), To: p.reportPath(to)})
+
+	if p.dryRun {
+		p.log("would move %s to %s\n", from, to)
+
+		return nil
+	}
+
+	p.log("moving %s to %s\n", from, to)
+
+	err := p.journal.mkdirAll(filepath.Dir(to))
+	if err != nil {
+		return fmt.Errorf("error creating directory %s: %w", filepath.Dir(to), err)
+	}
+
+	return p.journal.rename(from, to)
+}
+
+func (p *pkgMover) readGoMod(m *goModule) (*modfile.File, error) {
+	filename := filepath.Join(m.dir, "go.mod")
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", filename, err)
+	}
+
+	modFile, err := modfile.Parse(filename, data, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", filename, err)
+	}
+
+	return modFile, nil
+}
+
+// originalGoMod returns the go.mod file of m as it was before the move started changing it.
+func (p *pkgMover) originalGoMod(m *goModule) (*modfile.File, error) {
+	if m.original != nil {
+		return m.original, nil
+	}
+
+	modFile, err := p.readGoMod(m)
+	if err != nil {
+		return nil, err
+	}
+
+	m.original = modFile
+
+	return modFile, nil
+}
+
+// requireForImport returns the requirement of modFile that provides the package with the given import path, if any.
+func requireForImport(modFile *modfile.File, importPath string) *modfile.Require {
+	var found *modfile.Require
+
+	for _, req := range modFile.Require {
+		if importPath != req.Mod.Path && !strings.HasPrefix(importPath, req.Mod.Path+"/") {
+			continue
+		}
+
+		if found == nil || len(req.Mod.Path) > len(found.Mod.Path) {
+			found = req
+		}
+	}
+
+	return found
+}
+
+// localReplacement turns a relative file path into the form the go command requires for directory replacements.
+func localReplacement(rel string) string {
+	rel = filepath.ToSlash(rel)
+	if rel != ".." && !strings.HasPrefix(rel, "../") {
+		rel = "./" + rel
+	}
+
+	return rel
+}
+
+func importPathOf(literal string) (string, error) {
+	importPath, err := strconv.Unquote(literal)
+	if err != nil {
+		return "", fmt.Errorf("invalid import path %s: %w", literal, err)
+	}
+
+	return importPath, nil
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix+" ") || strings.HasPrefix(s, prefix+"/go.mod ") {
+			return true
+		}
+	}
+
+	return false
+}
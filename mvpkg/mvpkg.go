@@ -0,0 +1,927 @@
+// Package mvpkg moves Go packages, declarations and modules around, rewriting every import and reference to them in
+// the modules involved. Run runs one of the commands described by Options, NewPlan and Apply plan the changes and make
+// them separately, and Undo restores the files changed by the last command.
+package mvpkg
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"go/types"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/tools/go/ast/astutil"
+	"golang.org/x/tools/go/packages"
+)
+
+type pkgMover struct {
+	log               func(s string, args ...interface{})
+	dryRun            bool
+	merge             bool
+	journal           *journal
+	moduleDir         string
+	modules           map[string]*goModule
+	workFile          string
+	pkgs              []*packages.Package
+	fset              *token.FileSet
+	files             map[string]*loadedFile
+	alreadyMovedPkgs  map[string]string
+	alreadyMovedFiles map[string]string
+	// touchedFiles maps the files that were moved or rewritten, by the path they were loaded from, to the module
+	// they were loaded from
+	touchedFiles map[string]*goModule
+	printConfig  *printer.Config
+	// aliasPattern is the pattern of the aliases given to imports whose name is already taken in a file
+	aliasPattern string
+	// aliasPolicy decides what happens to the imports of a renamed package in its importers
+	aliasPolicy string
+	// qualifyDotImports turns the dot imports of moved packages into qualified imports
+	qualifyDotImports bool
+	// aliases are the aliases given to imports whose name was already taken, reported once the move is done
+	aliases []importAlias
+	// diff receives the changes as a patch instead of leaving them on disk if it's set
+	diff io.Writer
+	// jsonOut receives the report as JSON once the command is done if it's set
+	jsonOut io.Writer
+	// report records what the command does for jsonOut
+	report report
+	// ctx cancels the command, its changes are rolled back
+	ctx context.Context
+	// plan receives the changes instead of leaving them on disk if it's set
+	plan *Plan
+}
+
+// loadedFile is the syntax tree of a file together with the type information of the package it was loaded with.
+// The syntax tree is updated in place as the file is rewritten so that the type information stays valid across moves.
+type loadedFile struct {
+	file    *ast.File
+	info    *types.Info
+	pkgPath string
+	// constraints describes the build configurations the file is built in if the current one excludes it
+	constraints string
+}
+
+// Errors returned when the module containing the working directory can't be found.
+var (
+	ErrNoGoMod      = fmt.Errorf("couldn't find go.mod file")
+	ErrNoModulePath = fmt.Errorf("go.mod file has no module directive")
+)
+
+// init finds the main module, the one containing pwd, and the other modules in its workspace.
+// Source and destination paths are relative to the root of the main module.
+func (p *pkgMover) init(pwd string) error {
+	mod, modDir, err := goModuleNameAndPath(pwd)
+	if err != nil {
+		return err
+	}
+
+	p.moduleDir = modDir
+	p.modules = map[string]*goModule{modDir: {path: mod, dir: modDir}}
+
+	err = p.addWorkspaceModules()
+	if err != nil {
+		return err
+	}
+
+	// diff and plan modes go through the same changes as the command before rolling them back
+	if p.diff != nil || p.plan != nil {
+		return p.checkWritable()
+	}
+
+	return nil
+}
+
+// resolvePairs sets the import paths of the move pairs and registers the modules containing them,
+// so that importers in all of them are loaded and rewritten.
+func (p *pkgMover) resolvePairs(mPairs []movePair) error {
+	for i := range mPairs {
+		var err error
+
+		mPairs[i].srcPkgPath, err = p.pkgPathFor(mPairs[i].src)
+		if err != nil {
+			return err
+		}
+
+		mPairs[i].dstPkgPath, err = p.pkgPathFor(mPairs[i].dst)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// load loads the packages of every module taking part in the move.
+func (p *pkgMover) load(flags []string) error {
+	p.fset = token.NewFileSet()
+	p.files = map[string]*loadedFile{}
+	mode := packages.NeedName | packages.NeedFiles | packages.NeedCompiledGoFiles | packages.NeedImports | packages.NeedSyntax | packages.NeedTypes | packages.NeedTypesInfo | packages.NeedEmbedFiles | packages.NeedEmbedPatterns
+
+	for _, m := range p.sortedModules() {
+		loadPath := m.path + "/..."
+		p.log("Loading %s\n", loadPath)
+
+		pkgs, err := packages.Load(&packages.Config{Context: p.ctx, Tests: true, BuildFlags: flags, Dir: m.dir, Env: p.env(), Fset: p.fset, Mode: mode}, loadPath)
+		if err != nil {
+			// the error of the go command doesn't wrap the cancellation that caused it
+			if ctxErr := p.ctx.Err(); ctxErr != nil {
+				err = ctxErr
+			}
+
+			return fmt.Errorf("error loading packages %s: %w", loadPath, err)
+		}
+
+		p.log("Loaded %d packages\n", len(pkgs))
+		p.pkgs = append(p.pkgs, pkgs...)
+
+		for _, pkg := range pkgs {
+			goFiles := map[string]bool{}
+			for _, filename := range pkg.GoFiles {
+				goFiles[filename] = true
+			}
+
+			for i, file := range pkg.Syntax {
+				filename := pkg.CompiledGoFiles[i]
+				// cgo compiles generated files from the build cache instead of the files importing "C", those are
+				// parsed by loadCgoFiles
+				if !goFiles[filename] {
+					continue
+				}
+
+				// the same file shows up in both a package and its test variant, either one can be used
+				if _, ok := p.files[filename]; !ok {
+					p.files[filename] = &loadedFile{file: file, info: pkg.TypesInfo, pkgPath: pkg.PkgPath}
+				}
+			}
+		}
+	}
+
+	p.loadCgoFiles()
+	p.loadIgnoredFiles()
+
+	return nil
+}
+
+// loadCgoFiles parses the files of the loaded packages that import "C", the packages only hold the files cgo generates
+// from them. Like the files excluded by the build constraints, they aren't type checked, so their references are only
+// resolved syntactically.
+func (p *pkgMover) loadCgoFiles() {
+	for _, pkg := range p.pkgs {
+		for _, filename := range pkg.GoFiles {
+			if _, ok := p.files[filename]; ok {
+				continue
+			}
+
+			file, err := parser.ParseFile(p.fset, filename, nil, parser.ParseComments)
+			if err != nil {
+				p.log("skipping %s: %s\n", filename, err)
+
+				continue
+			}
+
+			p.files[filename] = &loadedFile{file: file, info: p.syntacticInfo(file, pkg.PkgPath), pkgPath: pkg.PkgPath}
+		}
+	}
+}
+
+// packageNames returns the name of the source package of mPair and the name it has at the destination. The
+// destination name is the one asked for, if any. Otherwise a package named as expected from its import path is renamed
+// as expected from the destination import path, while a package named differently, like redis in go-redis, keeps its
+// name. A package split off from another one is named as expected from its import path, and a package merged into
+// another one takes its name.
+func (p *pkgMover) packageNames(mPair movePair) (string, string) {
+	name := p.pkgName(mPair.srcPkgPath)
+
+	switch {
+	case p.merge:
+		// the source package becomes part of the existing destination package
+		return name, p.pkgName(mPair.dstPkgPath)
+	case mPair.name != "":
+		return name, mPair.name
+	case mPair.files == nil && name != packageNameFor(mPair.srcPkgPath):
+		return name, name
+	default:
+		return name, packageNameFor(mPair.dstPkgPath)
+	}
+}
+
+// renamePackageName returns the package name a file should have after its package is renamed from from to to.
+func renamePackageName(name, from, to string) string {
+	switch name {
+	case from:
+		return to
+	case from + "_test":
+		return to + "_test"
+	default:
+		return name
+	}
+}
+
+// renamePackageClause rewrites the package clause of the given file for its package being renamed from from to to,
+// and updates its canonical import comment, if it has one, to the new import path. Only the package clause is parsed,
+// the rest of the file is kept as it is.
+func (p *pkgMover) renamePackageClause(filename, from, to, importPath string) error {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("failed to read after move of %s: %w", filename, err)
+	}
+
+	fset := token.NewFileSet()
+
+	file, err := parser.ParseFile(fset, filename, data, parser.PackageClauseOnly|parser.ParseComments)
+	if err != nil {
+		return fmt.Errorf("failed to parse the package clause of %s: %w", filename, err)
+	}
+
+	offset := func(pos token.Pos) int {
+		return fset.Position(pos).Offset
+	}
+
+	edits := []textEdit{}
+
+	if name := renamePackageName(file.Name.Name, from, to); name != file.Name.Name {
+		edits = append(edits, textEdit{start: offset(file.Name.Pos()), end: offset(file.Name.End()), text: name})
+	}
+
+	if comment := importComment(fset, file); comment != nil {
+		edits = append(edits, textEdit{
+			start: offset(comment.Pos()),
+			end:   offset(comment.End()),
+			text:  importCommentText(comment.Text, importPath),
+		})
+	}
+
+	if len(edits) == 0 {
+		return nil
+	}
+
+	err = p.journal.writeFile(filename, []byte(applyEdits(string(data), edits)))
+	if err != nil {
+		return fmt.Errorf("failed to write after package rename of %s: %w", filename, err)
+	}
+
+	return nil
+}
+
+// importComment returns the canonical import comment of the file, the comment following the package clause on the
+// same line, or nil if there is none.
+func importComment(fset *token.FileSet, file *ast.File) *ast.Comment {
+	line := fset.Position(file.Name.Pos()).Line
+
+	for _, group := range file.Comments {
+		for _, comment := range group.List {
+			if comment.Pos() < file.Name.End() || fset.Position(comment.Pos()).Line != line {
+				continue
+			}
+
+			text := strings.TrimSpace(strings.TrimSuffix(comment.Text[2:], "*/"))
+			if strings.HasPrefix(text, "import ") {
+				return comment
+			}
+		}
+	}
+
+	return nil
+}
+
+// importCommentText returns the text of an import comment written like comment for the given import path.
+func importCommentText(comment, importPath string) string {
+	if strings.HasPrefix(comment, "/*") {
+		return "/* import " + strconv.Quote(importPath) + " */"
+	}
+
+	return "// import " + strconv.Quote(importPath)
+}
+
+func (p *pkgMover) move(mPair movePair) error {
+	src, dst := mPair.src, mPair.dst
+	srcPkgPath, dstPkgPath := mPair.srcPkgPath, mPair.dstPkgPath
+	// files excluded by the build constraints belong to the package too and must not be left behind
+	srcFiles := p.movedFiles(mPair)
+
+	if len(srcFiles) == 0 && !mPair.tree {
+		// nothing to move
+		return nil
+	}
+
+	dstDir := path.Join(p.moduleDir, dst)
+
+	if p.dryRun {
+		p.log("would create directory %s\n", dstDir)
+	} else {
+		p.log("creating directory %s\n", dstDir)
+		err := p.journal.mkdirAll(dstDir)
+		if err != nil {
+			return fmt.Errorf("error creating directory %s: %w", dstDir, err)
+		}
+	}
+
+	renameFrom, renameTo := p.packageNames(mPair)
+	importPath := p.getPkgPath(dstPkgPath)
+
+	for _, filename := range srcFiles {
+		newPath := path.Join(dstDir, path.Base(filename))
+
+		if newPath == filename {
+			// the package stays where it is, but its import path changes
+			p.log("keeping %s\n", filename)
+		} else {
+			err := p.moveFile(filename, newPath)
+			if err != nil {
+				return err
+			}
+		}
+
+		if !p.dryRun && strings.HasSuffix(newPath, ".go") {
+			err := p.renamePackageClause(newPath, renameFrom, renameTo, importPath)
+			if err != nil {
+				return err
+			}
+		}
+
+		// keep the syntax tree in sync with the renamed package clause in case the file is rewritten again later
+		if loaded, ok := p.files[filename]; ok {
+			loaded.file.Name.Name = renamePackageName(loaded.file.Name.Name, renameFrom, renameTo)
+
+			if comment := importComment(p.fset, loaded.file); comment != nil {
+				comment.Text = importCommentText(comment.Text, importPath)
+			}
+		}
+
+		err := p.touch(filename)
+		if err != nil {
+			return err
+		}
+
+		p.alreadyMovedFiles[filename] = newPath
+	}
+
+	// the source package still exists if only some of its files were moved
+	if mPair.files == nil {
+		srcDir := path.Join(p.moduleDir, src)
+
+		err := p.moveAssets(srcPkgPath, srcDir, dstDir)
+		if err != nil {
+			return err
+		}
+
+		if !p.dryRun {
+			err = p.checkEmbeds(srcPkgPath, srcDir, dstDir)
+			if err != nil {
+				return err
+			}
+		}
+
+		if mPair.tree {
+			err = p.moveDirFiles(srcDir, dstDir)
+			if err != nil {
+				return err
+			}
+
+			err = p.moveSubdirs(srcDir, dstDir, mPair.dirs)
+			if err != nil {
+				return err
+			}
+		}
+
+		p.alreadyMovedPkgs[srcPkgPath] = dstPkgPath
+		p.alreadyMovedPkgs[srcPkgPath+"_test"] = dstPkgPath + "_test"
+	}
+
+	return nil
+}
+
+// importers returns the loaded packages that import the package with the given path.
+func (p *pkgMover) importers(pkgPath string) []*packages.Package {
+	importers := []*packages.Package{}
+
+	for _, pkg := range p.pkgs {
+		// the generated main packages of test binaries live in the build cache and must not be touched
+		if strings.HasSuffix(pkg.ID, ".test") {
+			continue
+		}
+
+		if _, ok := pkg.Imports[pkgPath]; ok {
+			importers = append(importers, pkg)
+		}
+	}
+
+	return importers
+}
+
+func (p *pkgMover) fixImports(mPair movePair) error {
+	importedPath := p.getPkgPath(mPair.srcPkgPath)
+	packagesToFix := p.importers(importedPath)
+
+	p.log("Updating packages: %d\n", len(packagesToFix))
+
+	// a file can show up in more than one package when test variants are loaded
+	fixedFiles := map[string]struct{}{}
+	filenames := []string{}
+
+	for _, pkg := range packagesToFix {
+		for _, filename := range pkg.GoFiles {
+			if _, ok := fixedFiles[filename]; !ok {
+				fixedFiles[filename] = struct{}{}
+				filenames = append(filenames, filename)
+			}
+		}
+	}
+
+	// files excluded by the current build configuration aren't part of the loaded packages, but they may be built
+	// somewhere else
+	for _, filename := range p.ignoredImporters(importedPath) {
+		p.warnConstrained(p.files[filename], filename)
+		filenames = append(filenames, filename)
+	}
+
+	for _, filename := range filenames {
+		err := p.ctx.Err()
+		if err != nil {
+			return err
+		}
+
+		// the import path doesn't change, but the importers may still need a requirement on the package's new module
+		if mPair.srcPkgPath == mPair.dstPkgPath {
+			err = p.touch(filename)
+			if err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		err = p.fixImportsInFile(mPair, filename)
+		if err != nil {
+			return fmt.Errorf("failed to fix imports in %s: %w", p.getFilePath(filename), err)
+		}
+	}
+
+	return nil
+}
+
+// fixImportsInFile rewrites the imports of the source package in the given file and renames the identifiers
+// that refer to it. filename is the path the file was loaded from, which may have been moved since.
+func (p *pkgMover) fixImportsInFile(mPair movePair, filename string) error {
+	srcPkgPath := mPair.srcPkgPath
+	dstPkgPath := p.getPkgPath(mPair.dstPkgPath)
+	renameFrom, renameTo := p.packageNames(mPair)
+
+	loaded, ok := p.files[filename]
+	if !ok {
+		return fmt.Errorf("no syntax loaded for file %s", filename)
+	}
+
+	astFile := loaded.file
+
+	if p.merge {
+		handled, err := p.fixMergedImportsInFile(mPair, filename)
+		if handled || err != nil {
+			return err
+		}
+	}
+
+	if !astutil.RewriteImport(p.fset, astFile, p.getPkgPath(srcPkgPath), dstPkgPath) {
+		return nil
+	}
+
+	ast.SortImports(p.fset, astFile)
+
+	renamed := 0
+
+	for _, imp := range astFile.Imports {
+		if imp.Path.Value != strconv.Quote(dstPkgPath) {
+			continue
+		}
+
+		n, err := p.renameImport(loaded, imp, srcPkgPath, dstPkgPath, renameFrom, renameTo)
+		if err != nil {
+			return err
+		}
+
+		renamed += n
+	}
+
+	p.recordRewrite(p.getFilePath(filename), renamed)
+
+	return p.writeSyntax(filename)
+}
+
+// writeSyntax prints the syntax tree of the given file, which may have been moved since it was loaded, back to disk.
+func (p *pkgMover) writeSyntax(filename string) error {
+	astFile := p.files[filename].file
+
+	var buf bytes.Buffer
+
+	err := p.printConfig.Fprint(&buf, p.fset, astFile)
+	if err != nil {
+		return fmt.Errorf("error formatting file %s: %w", astFile.Name.Name, err)
+	}
+
+	err = p.touch(filename)
+	if err != nil {
+		return err
+	}
+
+	return p.writeFile(p.getFilePath(filename), buf.Bytes())
+}
+
+// refersToPackage returns true if the identifier resolves to the import of the package with the given path.
+func refersToPackage(info *types.Info, ident *ast.Ident, pkgPath string) bool {
+	pkgName, ok := info.Uses[ident].(*types.PkgName)
+	if !ok {
+		return false
+	}
+
+	return pkgName.Imported().Path() == pkgPath
+}
+
+func (p *pkgMover) getPkgPath(path string) string {
+	newPath, ok := p.alreadyMovedPkgs[path]
+	if ok {
+		return newPath
+	}
+
+	return path
+}
+
+// getFilePath is meant to be used on files (not directories) with file paths relative to the root of the module.
+func (p *pkgMover) getFilePath(filePath string) string {
+	newPath, ok := p.alreadyMovedFiles[filePath]
+	if ok {
+		return newPath
+	}
+
+	return filePath
+}
+
+type movePair struct {
+	src        string
+	dst        string
+	srcPkgPath string
+	dstPkgPath string
+	// files restricts the move to some of the files of the source package, all of them are moved if it's nil
+	files []string
+	// name is the name of the package at the destination, it's derived from the destination import path if empty
+	name string
+	// tree is set when the whole directory tree moves, so the files that don't belong to the package move too
+	tree bool
+	// dirs are the subdirectories that can't contain packages, like testdata, and move as they are with the tree
+	dirs []string
+}
+
+func newPkgMover(printf func(s string, args ...interface{}), diff, jsonOut io.Writer, dryRun bool) *pkgMover {
+	return &pkgMover{
+		log:               printf,
+		dryRun:            dryRun,
+		diff:              diff,
+		jsonOut:           jsonOut,
+		ctx:               context.Background(),
+		report:            report{Pairs: []reportPair{}, Moves: []reportMove{}, Rewrites: []*reportRewrite{}, Warnings: []string{}},
+		journal:           &journal{},
+		alreadyMovedPkgs:  map[string]string{},
+		alreadyMovedFiles: map[string]string{},
+		touchedFiles:      map[string]*goModule{},
+		printConfig:       &printer.Config{Mode: printer.UseSpaces | printer.TabIndent, Tabwidth: 8},
+		aliasPattern:      defaultAliasPattern,
+		aliasPolicy:       aliasRename,
+	}
+}
+
+// runMove runs CommandMove: it moves the package at opts.Src to opts.Dst. Either path may be inside another module
+// than the one containing opts.Pwd, in which case the go.mod files of the modules involved are updated so that they can
+// import each other's packages.
+// The package is called opts.Name at the destination. If it's empty, a package named as expected from its import path
+// is renamed as expected from the destination import path, and other packages keep their name.
+// opts.AliasPolicy decides what happens to the imports of the renamed package: rename, the default, keep-name,
+// drop-redundant or mirror.
+// Dot imports of the package are turned into qualified imports if opts.QualifyDotImports is set, otherwise they are
+// kept as long as the names they bring in don't collide with the importer's.
+func (p *pkgMover) runMove(opts Options) (err error) {
+	rootSrc := filepath.Clean(opts.Src)
+	rootDst := filepath.Clean(opts.Dst)
+
+	if opts.Name != "" {
+		err = checkPackageName(opts.Name)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = p.setAliasPattern(opts.AliasPattern)
+	if err != nil {
+		return err
+	}
+
+	err = p.setAliasPolicy(opts.AliasPolicy)
+	if err != nil {
+		return err
+	}
+
+	p.qualifyDotImports = opts.QualifyDotImports
+
+	err = p.init(opts.Pwd)
+	if err != nil {
+		return fmt.Errorf("failed to initialize mover: %w", err)
+	}
+
+	mPairs, err := p.findMovePairs(rootSrc, rootDst, opts.Recursive)
+	if err != nil {
+		return fmt.Errorf("failed to find move pairs: %w", err)
+	}
+
+	mPairs[0].name = opts.Name
+
+	err = p.resolvePairs(mPairs)
+	if err != nil {
+		return fmt.Errorf("failed to find modules: %w", err)
+	}
+
+	err = p.load(opts.BuildFlags)
+	if err != nil {
+		return fmt.Errorf("failed to initialize mover: %w", err)
+	}
+
+	err = p.checkDestinations(mPairs)
+	if err != nil {
+		return err
+	}
+
+	defer p.rollbackOnError(&err)
+
+	err = p.movePairs(mPairs)
+	if err != nil {
+		return err
+	}
+
+	err = p.fixGoMods()
+	if err != nil {
+		return fmt.Errorf("failed to update go.mod files: %w", err)
+	}
+
+	p.reportAliases()
+
+	return p.finish()
+}
+
+// movePairs fixes the importers of each pair and moves its files.
+func (p *pkgMover) movePairs(mPairs []movePair) error {
+	for _, mPair := range mPairs {
+		p.log("Move plan: %s -> %s\n", mPair.src, mPair.dst)
+	}
+
+	p.recordPairs(mPairs)
+
+	for _, mPair := range mPairs {
+		err := p.ctx.Err()
+		if err != nil {
+			return err
+		}
+
+		p.log("Processing %s -> %s\n", mPair.src, mPair.dst)
+
+		err = p.fixImports(mPair)
+		if err != nil {
+			return fmt.Errorf("failed to fix imports for %s -> %s: %w", mPair.src, mPair.dst, err)
+		}
+
+		err = p.move(mPair)
+		if err != nil {
+			return fmt.Errorf("failed to move %s to %s: %w", mPair.src, mPair.dst, err)
+		}
+	}
+
+	if p.dryRun {
+		return nil
+	}
+
+	// the source directories and their parents are pruned once everything inside them has moved
+	emptied := map[string]struct{}{}
+
+	for _, mPair := range mPairs {
+		if mPair.files != nil || mPair.src == mPair.dst {
+			continue
+		}
+
+		for dir := filepath.Join(p.moduleDir, mPair.src); !strings.HasPrefix(p.moduleDir, dir); dir = filepath.Dir(dir) {
+			emptied[dir] = struct{}{}
+		}
+	}
+
+	return p.pruneEmptyDirs(emptied)
+}
+
+// rollbackOnError rolls back all changes made to the filesystem if *err is set. It's meant to be deferred.
+func (p *pkgMover) rollbackOnError(err *error) {
+	if *err == nil {
+		return
+	}
+
+	p.log("rolling back changes\n")
+
+	rollbackErr := p.journal.rollback()
+	if rollbackErr != nil {
+		*err = fmt.Errorf("%w; rollback failed, the module may be left in a partially moved state: %v", *err, rollbackErr)
+	}
+}
+
+// finish completes a successful move. If diff or plan is set, the changes are written to it and rolled back, otherwise
+// they're saved to the journal so that they can be undone. Nothing was changed in a dry run.
+func (p *pkgMover) finish() error {
+	if p.dryRun {
+		return nil
+	}
+
+	if p.diff == nil && p.plan == nil {
+		p.saveJournal()
+
+		return nil
+	}
+
+	var err error
+
+	if p.diff != nil {
+		err = p.writeDiff(p.diff)
+	} else {
+		err = p.recordPlan()
+	}
+
+	rollbackErr := p.journal.rollback()
+	if rollbackErr != nil {
+		return fmt.Errorf("failed to roll back the changes once recorded, the module may be left in a partially moved state: %w", rollbackErr)
+	}
+
+	if err != nil || p.plan == nil {
+		return err
+	}
+
+	// the inputs are hashed as they were before the changes
+	return p.hashInputs()
+}
+
+// saveJournal persists the changes made by the move so that they can be undone.
+// Failing to save the journal doesn't fail the move, the move itself was successful.
+func (p *pkgMover) saveJournal() {
+	filename, root, err := journalPath(p.moduleDir)
+	if err != nil {
+		p.warn("not saving undo journal: %s\n", err)
+
+		return
+	}
+
+	p.log("saving undo journal to %s\n", filename)
+
+	err = p.journal.save(filename, root)
+	if err != nil {
+		p.warn("failed to save undo journal: %s\n", err)
+	}
+}
+
+// findMovePairs returns the packages to move: the source package and, in recursive mode, the packages in the
+// directories nested under it. Like the go command, the recursive walk leaves out nested modules, and the directories
+// that can't contain packages of the module are moved along with their parent as they are.
+func (p *pkgMover) findMovePairs(rootSrc, rootDst string, recursive bool) ([]movePair, error) {
+	mPairs := []movePair{{src: rootSrc, dst: rootDst, tree: recursive}}
+
+	// add additional packages to the list of packages to move if we are using recursive mode
+	if !recursive {
+		return mPairs, nil
+	}
+
+	rootDir := filepath.Join(p.moduleDir, rootSrc)
+
+	m, err := p.moduleFor(rootDir)
+	if err != nil {
+		return nil, err
+	}
+
+	modFile, err := p.originalGoMod(m)
+	if err != nil {
+		return nil, err
+	}
+
+	// the pair of each directory visited so far, by source path
+	pairIndex := map[string]int{rootSrc: 0}
+
+	err = filepath.WalkDir(rootDir, func(filePath string, entry fs.DirEntry, iterationErr error) error {
+		if iterationErr != nil {
+			return fmt.Errorf("iteration error: %w", iterationErr)
+		}
+
+		if !entry.IsDir() || filePath == rootDir {
+			return nil
+		}
+
+		if _, err := os.Stat(filepath.Join(filePath, "go.mod")); err == nil {
+			p.log("skipping nested module %s\n", filePath)
+
+			return filepath.SkipDir
+		}
+
+		srcFilePath, err := filepath.Rel(p.moduleDir, filePath)
+		if err != nil {
+			return fmt.Errorf("failed to parse walk path %s as relative to module root %s: %w", filePath, p.moduleDir, err)
+		}
+
+		// modify dst to include the suffix from src being a subdirectory
+		// XXX: we are still treating filepaths and module paths interchanably here
+		srcSuffix, err := filepath.Rel(rootSrc, srcFilePath)
+		if err != nil {
+			return fmt.Errorf("failed to parse srcFilePath %s as relative to rootSrc %s: %w", srcFilePath, rootSrc, err)
+		}
+
+		dst := path.Join(rootDst, filepath.ToSlash(srcSuffix))
+
+		modRel, err := filepath.Rel(m.dir, filePath)
+		if err != nil {
+			return fmt.Errorf("failed to make %s relative to %s: %w", filePath, m.dir, err)
+		}
+
+		if !packageDir(modFile, filepath.ToSlash(modRel)) {
+			containsModule, err := containsGoMod(filePath)
+			if err != nil {
+				return err
+			}
+
+			if containsModule {
+				p.log("skipping %s, it contains a nested module\n", filePath)
+			} else {
+				parent := &mPairs[pairIndex[filepath.Dir(srcFilePath)]]
+				parent.dirs = append(parent.dirs, entry.Name())
+			}
+
+			return filepath.SkipDir
+		}
+
+		pairIndex[srcFilePath] = len(mPairs)
+		mPairs = append(mPairs, movePair{src: srcFilePath, dst: dst, tree: true})
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk src tree: %w", err)
+	}
+
+	return mPairs, nil
+}
+
+// packageDir reports whether the directory rel, relative to the root of the module described by modFile, can contain
+// packages of the module. Like for the ... pattern of the go command, vendor, testdata and directories starting with
+// a dot or an underscore can't, and neither can the directories listed by ignore directives.
+func packageDir(modFile *modfile.File, rel string) bool {
+	name := path.Base(rel)
+	if name == "vendor" || name == "testdata" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") {
+		return false
+	}
+
+	for _, ignore := range modFile.Ignore {
+		ignored := path.Clean(ignore.Path)
+
+		// paths starting with ./ are relative to the module root, others match at any depth
+		if strings.HasPrefix(ignore.Path, "./") {
+			if rel == ignored {
+				return false
+			}
+		} else if rel == ignored || strings.HasSuffix(rel, "/"+ignored) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// containsGoMod reports whether there is a go.mod file anywhere in the directory tree under dir.
+func containsGoMod(dir string) (bool, error) {
+	found := false
+
+	err := filepath.WalkDir(dir, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !entry.IsDir() && entry.Name() == "go.mod" {
+			found = true
+
+			return filepath.SkipAll
+		}
+
+		return nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to walk %s: %w", dir, err)
+	}
+
+	return found, nil
+}
@@ -0,0 +1,677 @@
+package mvpkg_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/vikstrous/mvpkg/mvpkg"
+)
+
+const (
+	templateDir = "testtemplate"
+	testDir     = "testdir"
+)
+
+func cleanup() {
+	// ignore errors
+	os.RemoveAll(testDir)
+}
+
+func setup(tb testing.TB) {
+	tb.Helper()
+	cleanup()
+	// lazy test code... using a binary dependency rather than a library one
+	err := exec.Command("cp", "-r", templateDir, testDir).Run()
+	if err != nil {
+		tb.Fatalf("failed to create test dir: %s", err)
+	}
+
+	initGitDir(tb)
+}
+
+// initGitDir makes the test dir look like the root of a repository so that the undo journal
+// is written there rather than into the repository containing the tests.
+func initGitDir(tb testing.TB) {
+	tb.Helper()
+
+	err := os.Mkdir(filepath.Join(testDir, ".git"), 0o755)
+	if err != nil {
+		tb.Fatalf("failed to create .git dir: %s", err)
+	}
+}
+
+func compare(tb testing.TB, expected, actual string) {
+	tb.Helper()
+	// lazy test code... using a binary dependency rather than a library one
+	cmd := exec.Command("diff", "-r", "-x", ".git", expected, actual)
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	err := cmd.Run()
+	if err != nil {
+		tb.Fatalf("test comparison failed: %s\n%s\n%s\n", err, stdout.String(), stderr.String())
+	}
+}
+
+// testInfoFile describes the command run by a test in its testInfo.json file.
+type testInfoFile struct {
+	Command      string   `json:"command"`
+	PWD          string   `json:"pwd"`
+	Source       string   `json:"source"`
+	Destination  string   `json:"destination"`
+	ModulePath   string   `json:"module_path"`
+	Name         string   `json:"name"`
+	Forward      bool     `json:"forward"`
+	Files        string   `json:"files"`
+	Export       bool     `json:"export"`
+	Recursive    bool     `json:"recursive"`
+	AliasPattern string   `json:"alias_pattern"`
+	AliasPolicy  string   `json:"alias_policy"`
+	QualifyDot   bool     `json:"qualify_dot_imports"`
+	BuildFlags   []string `json:"build_flags"`
+	ExpectError  bool     `json:"expect_error"`
+}
+
+func readTestInfo(tb testing.TB, testSrcDir string) testInfoFile {
+	tb.Helper()
+
+	testInfoFilename := filepath.Join(testSrcDir, "testInfo.json")
+
+	testInfoStr, err := ioutil.ReadFile(testInfoFilename)
+	if err != nil {
+		tb.Fatalf("failed to read command file from %s: %s", testInfoFilename, err)
+	}
+
+	var testInfo testInfoFile
+
+	err = json.Unmarshal(testInfoStr, &testInfo)
+	if err != nil {
+		tb.Fatalf("failed to JSON unmarshal file from %s: %s", testInfoFilename, err)
+	}
+
+	return testInfo
+}
+
+// run runs the command of the test in pwd.
+func (testInfo testInfoFile) run(tb testing.TB, pwd string, diff, jsonOut io.Writer) error {
+	opts := testInfo.options(tb, pwd)
+	opts.Diff, opts.JSON = diff, jsonOut
+
+	_, err := mvpkg.Run(context.Background(), opts)
+
+	return err
+}
+
+// options returns the options of the command of the test run in pwd.
+func (testInfo testInfoFile) options(tb testing.TB, pwd string) mvpkg.Options {
+	opts := mvpkg.Options{
+		Command:           testInfo.Command,
+		Pwd:               pwd,
+		Src:               testInfo.Source,
+		Dst:               testInfo.Destination,
+		Name:              testInfo.Name,
+		Files:             testInfo.Files,
+		ModulePath:        testInfo.ModulePath,
+		AliasPattern:      testInfo.AliasPattern,
+		AliasPolicy:       testInfo.AliasPolicy,
+		BuildFlags:        testInfo.BuildFlags,
+		Recursive:         testInfo.Recursive,
+		QualifyDotImports: testInfo.QualifyDot,
+		Forward:           testInfo.Forward,
+		Export:            testInfo.Export,
+		Logger:            mvpkg.LoggerFunc(tb.Logf),
+	}
+
+	switch testInfo.Command {
+	case "decl":
+		// the name of a decl test is the name of the declaration
+		opts.Name, opts.Decl = "", testInfo.Name
+	case "extract-module", "merge-module":
+		opts.Dst = ""
+	}
+
+	return opts
+}
+
+func TestGeneric(t *testing.T) {
+	forEachFixture(t, func(t *testing.T, testSrcDir string, testInfo testInfoFile) {
+		// clean up before starting and between tests
+		cleanup()
+
+		originalPath := filepath.Join(testSrcDir, "original")
+		// using a binary dependency rather than a library one
+		err := exec.Command("cp", "-r", originalPath, testDir).Run()
+		if err != nil {
+			t.Fatalf("failed to create test dir running: %s", err)
+		}
+		initGitDir(t)
+		defer func() {
+			// leave the resulting failed output directory in place if the tests failed so we can inspect it
+			if !t.Failed() {
+				cleanup()
+			}
+		}()
+
+		expectedPath := filepath.Join(testSrcDir, "expected")
+
+		// run the tool
+		err = testInfo.run(t, filepath.Join(testDir, testInfo.PWD), nil, nil)
+		if testInfo.ExpectError {
+			if err == nil {
+				t.Fatalf("Run succeeded, but was expected to fail")
+			}
+		} else if err != nil {
+			t.Fatalf("Run fialed: %s", err)
+		}
+
+		// validate the results
+		compare(t, expectedPath, testDir)
+	})
+}
+
+// forEachFixture runs fn as a subtest for every fixture directory in tests, named after the directory without its
+// number.
+func forEachFixture(t *testing.T, fn func(t *testing.T, testSrcDir string, testInfo testInfoFile)) {
+	t.Helper()
+
+	testsDir := "tests"
+
+	testFiles, err := ioutil.ReadDir(testsDir)
+	if err != nil {
+		t.Fatalf("failed to read list of tests: %s", err)
+	}
+
+	for _, testFile := range testFiles {
+		if !testFile.IsDir() {
+			continue
+		}
+
+		testSrcDir := filepath.Join(testsDir, testFile.Name())
+		// Drop the number from the name
+		testName := strings.Join(strings.Split(testFile.Name(), "_")[1:], "_")
+
+		t.Run(testName, func(t *testing.T) {
+			fn(t, testSrcDir, readTestInfo(t, testSrcDir))
+		})
+	}
+}
+
+// TestDiff runs the tests in diff mode in a git repository and makes sure that the tree is left alone and that applying
+// the patch with git produces the expected results.
+func TestDiff(t *testing.T) {
+	_, err := exec.LookPath("git")
+	if err != nil {
+		t.Skip("git is not installed")
+	}
+
+	forEachFixture(t, func(t *testing.T, testSrcDir string, testInfo testInfoFile) {
+		if testInfo.ExpectError {
+			t.Skip("there is nothing to diff")
+		}
+
+		// a real repository outside of the one containing the tests, for git apply
+		repoDir := filepath.Join(t.TempDir(), "repo")
+		originalPath := filepath.Join(testSrcDir, "original")
+
+		err := exec.Command("cp", "-r", originalPath, repoDir).Run()
+		if err != nil {
+			t.Fatalf("failed to create test dir: %s", err)
+		}
+
+		err = exec.Command("git", "-C", repoDir, "init", "-q").Run()
+		if err != nil {
+			t.Fatalf("failed to initialize repository: %s", err)
+		}
+
+		patch := &bytes.Buffer{}
+
+		err = testInfo.run(t, filepath.Join(repoDir, testInfo.PWD), patch, nil)
+		if err != nil {
+			t.Fatalf("Run failed: %s", err)
+		}
+
+		compare(t, originalPath, repoDir)
+
+		cmd := exec.Command("git", "-C", repoDir, "apply", "-")
+		cmd.Stdin = patch
+
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("failed to apply the patch: %s\n%s", err, out)
+		}
+
+		compare(t, filepath.Join(testSrcDir, "expected"), repoDir)
+	})
+}
+
+// TestPlan makes sure that planning a command leaves the tree alone and that applying the plan once it went through
+// JSON, to another copy of the tree, makes the same changes as the command.
+func TestPlan(t *testing.T) {
+	forEachFixture(t, func(t *testing.T, testSrcDir string, testInfo testInfoFile) {
+		if testInfo.ExpectError {
+			t.Skip("there is nothing to plan")
+		}
+
+		repoDir := newRepo(t, testSrcDir)
+		originalPath := filepath.Join(testSrcDir, "original")
+
+		plan, err := mvpkg.NewPlan(context.Background(), testInfo.options(t, filepath.Join(repoDir, testInfo.PWD)))
+		if err != nil {
+			t.Fatalf("NewPlan failed: %s", err)
+		}
+
+		compare(t, originalPath, repoDir)
+
+		data, err := json.Marshal(plan)
+		if err != nil {
+			t.Fatalf("failed to marshal the plan: %s", err)
+		}
+
+		var decoded mvpkg.Plan
+
+		err = json.Unmarshal(data, &decoded)
+		if err != nil {
+			t.Fatalf("failed to unmarshal the plan: %s", err)
+		}
+
+		if strings.Contains(string(data), repoDir) {
+			t.Fatalf("the plan refers to %s: %s", repoDir, data)
+		}
+
+		otherDir := newRepo(t, testSrcDir)
+
+		_, err = mvpkg.Apply(context.Background(), &decoded, filepath.Join(otherDir, testInfo.PWD))
+		if err != nil {
+			t.Fatalf("Apply failed: %s", err)
+		}
+
+		compare(t, originalPath, repoDir)
+		compare(t, filepath.Join(testSrcDir, "expected"), otherDir)
+	})
+}
+
+// TestPlanRefusesChangedFiles makes sure that a plan isn't applied once one of the files it was computed from changed.
+func TestPlanRefusesChangedFiles(t *testing.T) {
+	testSrcDir := filepath.Join("tests", "22_package_name_derived")
+	testInfo := readTestInfo(t, testSrcDir)
+	repoDir := newRepo(t, testSrcDir)
+
+	plan, err := mvpkg.NewPlan(context.Background(), testInfo.options(t, filepath.Join(repoDir, testInfo.PWD)))
+	if err != nil {
+		t.Fatalf("NewPlan failed: %s", err)
+	}
+
+	changed := filepath.Join(repoDir, "depender", "depender.go")
+
+	err = ioutil.WriteFile(changed, []byte("package depender\n"), 0o600)
+	if err != nil {
+		t.Fatalf("failed to change %s: %s", changed, err)
+	}
+
+	_, err = mvpkg.Apply(context.Background(), plan, filepath.Join(repoDir, testInfo.PWD))
+	if !errors.Is(err, mvpkg.ErrPlanStale) || !strings.Contains(err.Error(), "depender/depender.go") {
+		t.Fatalf("Apply didn't refuse the stale plan: %v", err)
+	}
+
+	// nothing should have been applied
+	_, err = os.Stat(filepath.Join(repoDir, "source", "util", "util.go"))
+	if err != nil {
+		t.Fatalf("Apply touched the tree after refusing: %s", err)
+	}
+}
+
+// newRepo copies the original tree of a test to a new repository and returns its root.
+func newRepo(tb testing.TB, testSrcDir string) string {
+	tb.Helper()
+
+	repoDir := filepath.Join(tb.TempDir(), "repo")
+
+	err := exec.Command("cp", "-r", filepath.Join(testSrcDir, "original"), repoDir).Run()
+	if err != nil {
+		tb.Fatalf("failed to create test dir: %s", err)
+	}
+
+	err = os.Mkdir(filepath.Join(repoDir, ".git"), 0o700)
+	if err != nil {
+		tb.Fatalf("failed to create git dir: %s", err)
+	}
+
+	return repoDir
+}
+
+// TestJSON makes sure that the report lists the pairs, moves and rewrites of a dry run, and the error of a failed run.
+func TestJSON(t *testing.T) {
+	type plan struct {
+		DryRun bool `json:"dry_run"`
+		Pairs  []struct {
+			Src        string `json:"src"`
+			DstPkgPath string `json:"dst_pkg_path"`
+		} `json:"pairs"`
+		Moves []struct {
+			From string `json:"from"`
+			To   string `json:"to"`
+		} `json:"moves"`
+		Rewrites []struct {
+			File             string `json:"file"`
+			RenamedSelectors int    `json:"renamed_selectors"`
+		} `json:"rewrites"`
+		Warnings []string `json:"warnings"`
+		Result   struct {
+			Success bool   `json:"success"`
+			Error   string `json:"error"`
+		} `json:"result"`
+	}
+
+	run := func(t *testing.T, test string) plan {
+		t.Helper()
+
+		cleanup()
+
+		err := exec.Command("cp", "-r", filepath.Join("tests", test, "original"), testDir).Run()
+		if err != nil {
+			t.Fatalf("failed to create test dir: %s", err)
+		}
+
+		initGitDir(t)
+
+		testInfo := readTestInfo(t, filepath.Join("tests", test))
+		out := &bytes.Buffer{}
+
+		// a dry run, so that the tree is left alone
+		opts := mvpkg.Options{Pwd: testDir, Src: testInfo.Source, Dst: testInfo.Destination, Logger: mvpkg.LoggerFunc(t.Logf), DryRun: true, JSON: out}
+
+		_, _ = mvpkg.Run(context.Background(), opts)
+
+		compare(t, filepath.Join("tests", test, "original"), testDir)
+
+		var p plan
+
+		err = json.Unmarshal(out.Bytes(), &p)
+		if err != nil {
+			t.Fatalf("failed to unmarshal the plan: %s\n%s", err, out.String())
+		}
+
+		return p
+	}
+
+	defer cleanup()
+
+	t.Run("success", func(t *testing.T) {
+		p := run(t, "22_package_name_derived")
+
+		if !p.DryRun || !p.Result.Success || p.Result.Error != "" {
+			t.Fatalf("unexpected result: %+v", p)
+		}
+
+		if len(p.Pairs) != 1 || p.Pairs[0].Src != "source/util" || p.Pairs[0].DstPkgPath != "example.com/destination/my-lib/v3" {
+			t.Fatalf("unexpected pairs: %+v", p.Pairs)
+		}
+
+		if len(p.Moves) != 2 || p.Moves[0].From != "source/util/util.go" || p.Moves[0].To != "destination/my-lib/v3/util.go" {
+			t.Fatalf("unexpected moves: %+v", p.Moves)
+		}
+
+		if len(p.Rewrites) != 1 || p.Rewrites[0].File != "depender/depender.go" || p.Rewrites[0].RenamedSelectors != 1 {
+			t.Fatalf("unexpected rewrites: %+v", p.Rewrites)
+		}
+	})
+
+	t.Run("warnings", func(t *testing.T) {
+		// the paths in the warnings are relative like every other path of the report
+		p := run(t, "17_build_constraint_importers")
+
+		if len(p.Warnings) == 0 {
+			t.Fatalf("no warnings: %+v", p)
+		}
+
+		for _, warning := range p.Warnings {
+			if strings.Contains(warning, testDir) {
+				t.Fatalf("warning with an absolute path: %s", warning)
+			}
+		}
+
+		p = run(t, "23_import_collision")
+
+		if !slices.ContainsFunc(p.Warnings, func(warning string) bool { return strings.Contains(warning, " in depender/depender.go,") }) {
+			t.Fatalf("unexpected warnings: %+v", p.Warnings)
+		}
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		// a regular move refuses to move onto the destination package of the merge
+		p := run(t, "10_merge_pkg")
+
+		if p.Result.Success || p.Result.Error == "" {
+			t.Fatalf("unexpected result: %+v", p.Result)
+		}
+	})
+}
+
+// basicOptions returns the options of the move made in the template test dir.
+func basicOptions(tb testing.TB) mvpkg.Options {
+	return mvpkg.Options{
+		Pwd:        testDir + "/destination",
+		Src:        "source/testpkg",
+		Dst:        "destination/testpkg2",
+		BuildFlags: []string{"-tags=special"},
+		Logger:     mvpkg.LoggerFunc(tb.Logf),
+	}
+}
+
+func TestBasic(t *testing.T) {
+	setup(t)
+
+	defer cleanup()
+
+	// execute the package move
+	result, err := mvpkg.Run(context.Background(), basicOptions(t))
+	if err != nil {
+		t.Fatalf("failed to run mvpkg: %s", err)
+	}
+
+	// validate the results
+	compare(t, "expected", testDir)
+
+	moved := mvpkg.Change{OldPath: "source/testpkg/testpkg.go", NewPath: "destination/testpkg2/testpkg.go"}
+	if !slices.Contains(result.Moved, moved) || !slices.Contains(result.Rewritten, "destination/destination.go") {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+}
+
+// TestCancel makes sure that a cancelled command leaves the tree alone.
+func TestCancel(t *testing.T) {
+	setup(t)
+
+	defer cleanup()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := mvpkg.Run(ctx, basicOptions(t))
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	compare(t, templateDir, testDir)
+
+	// cancelled while the packages load, which fails with an error of the go command
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+
+	opts := basicOptions(t)
+	opts.Logger = mvpkg.LoggerFunc(func(s string, args ...interface{}) {
+		if strings.HasPrefix(s, "Loading ") {
+			cancel()
+		}
+	})
+
+	_, err = mvpkg.Run(ctx, opts)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	compare(t, templateDir, testDir)
+}
+
+func TestNoGoMod(t *testing.T) {
+	_, err := mvpkg.Run(context.Background(), mvpkg.Options{Pwd: t.TempDir(), Src: "a", Dst: "b"})
+	if !errors.Is(err, mvpkg.ErrNoGoMod) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestRecursive(t *testing.T) {
+	setup(t)
+
+	defer cleanup()
+
+	// execute the package move
+	opts := basicOptions(t)
+	opts.Recursive = true
+
+	_, err := mvpkg.Run(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("failed to run mvpkg: %s", err)
+	}
+
+	// validate the results
+	compare(t, "expected-recursive", testDir)
+}
+
+func TestUndo(t *testing.T) {
+	setup(t)
+
+	defer cleanup()
+
+	_, err := mvpkg.Run(context.Background(), basicOptions(t))
+	if err != nil {
+		t.Fatalf("failed to run mvpkg: %s", err)
+	}
+
+	err = mvpkg.Undo(context.Background(), testDir, mvpkg.LoggerFunc(t.Logf))
+	if err != nil {
+		t.Fatalf("failed to undo: %s", err)
+	}
+
+	// validate the results
+	compare(t, templateDir, testDir)
+
+	err = mvpkg.Undo(context.Background(), testDir, mvpkg.LoggerFunc(t.Logf))
+	if !errors.Is(err, mvpkg.ErrNoJournal) {
+		t.Fatalf("undo succeeded twice: %v", err)
+	}
+}
+
+// TestFileModes makes sure that new files can be read by everyone and that undo restores the mode of removed files.
+func TestFileModes(t *testing.T) {
+	testSrcDir := filepath.Join("tests", "08_extract_module")
+	repoDir := newRepo(t, testSrcDir)
+
+	_, err := mvpkg.Run(context.Background(), readTestInfo(t, testSrcDir).options(t, repoDir))
+	if err != nil {
+		t.Fatalf("failed to run mvpkg: %s", err)
+	}
+
+	checkMode(t, filepath.Join(repoDir, "pkg", "sdk", "go.mod"), 0o644)
+
+	testSrcDir = filepath.Join("tests", "09_merge_module")
+	repoDir = newRepo(t, testSrcDir)
+	goMod := filepath.Join(repoDir, "lib", "go.mod")
+
+	err = os.Chmod(goMod, 0o640)
+	if err != nil {
+		t.Fatalf("failed to change the mode of %s: %s", goMod, err)
+	}
+
+	_, err = mvpkg.Run(context.Background(), readTestInfo(t, testSrcDir).options(t, repoDir))
+	if err != nil {
+		t.Fatalf("failed to run mvpkg: %s", err)
+	}
+
+	err = mvpkg.Undo(context.Background(), repoDir, mvpkg.LoggerFunc(t.Logf))
+	if err != nil {
+		t.Fatalf("failed to undo: %s", err)
+	}
+
+	checkMode(t, goMod, 0o640)
+}
+
+func checkMode(tb testing.TB, filename string, mode os.FileMode) {
+	tb.Helper()
+
+	info, err := os.Stat(filename)
+	if err != nil {
+		tb.Fatalf("failed to stat %s: %s", filename, err)
+	}
+
+	if info.Mode().Perm() != mode {
+		tb.Fatalf("unexpected mode of %s: %s", filename, info.Mode().Perm())
+	}
+}
+
+func TestUndoRefusesChangedFiles(t *testing.T) {
+	setup(t)
+
+	defer cleanup()
+
+	_, err := mvpkg.Run(context.Background(), basicOptions(t))
+	if err != nil {
+		t.Fatalf("failed to run mvpkg: %s", err)
+	}
+
+	changed := filepath.Join(testDir, "destination", "destination.go")
+
+	err = ioutil.WriteFile(changed, []byte("package destination\n"), 0o600)
+	if err != nil {
+		t.Fatalf("failed to change %s: %s", changed, err)
+	}
+
+	err = mvpkg.Undo(context.Background(), testDir, mvpkg.LoggerFunc(t.Logf))
+	if !errors.Is(err, mvpkg.ErrTreeChanged) {
+		t.Fatalf("undo succeeded after files changed: %v", err)
+	}
+
+	// nothing should have been undone
+	_, err = os.Stat(filepath.Join(testDir, "destination", "testpkg2"))
+	if err != nil {
+		t.Fatalf("undo touched the tree after refusing: %s", err)
+	}
+}
+
+// TestDiffRefusesReadOnlyModule makes sure that diff mode, which makes the changes on disk before rolling them back,
+// refuses to run when the module can't be written to instead of failing part way through.
+func TestDiffRefusesReadOnlyModule(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root can write to read only directories")
+	}
+
+	testSrcDir := filepath.Join("tests", "01_trivial")
+	testInfo := readTestInfo(t, testSrcDir)
+	repoDir := newRepo(t, testSrcDir)
+
+	err := os.Chmod(repoDir, 0o555)
+	if err != nil {
+		t.Fatalf("failed to make %s read only: %s", repoDir, err)
+	}
+
+	defer os.Chmod(repoDir, 0o755) //nolint:errcheck // the temporary directory is removed either way
+
+	err = testInfo.run(t, filepath.Join(repoDir, testInfo.PWD), &bytes.Buffer{}, nil)
+	if !errors.Is(err, mvpkg.ErrNotWritable) {
+		t.Fatalf("diff mode didn't refuse the read only module: %v", err)
+	}
+
+	compare(t, filepath.Join(testSrcDir, "original"), repoDir)
+}
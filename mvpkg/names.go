@@ -0,0 +1,358 @@
+package mvpkg
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"path"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// defaultAliasPattern is the pattern of the aliases given to imports whose name is already taken in a file.
+const defaultAliasPattern = "{name}{n}"
+
+// The alias policies decide what happens to the imports of a renamed package in its importers.
+const (
+	// aliasRename renames the references through unaliased imports and leaves aliased imports alone
+	aliasRename = "rename"
+	// aliasKeepName gives unaliased imports an alias with the old name, so that the references don't change
+	aliasKeepName = "keep-name"
+	// aliasDropRedundant renames like aliasRename and drops the aliases that are the same as the new name
+	aliasDropRedundant = "drop-redundant"
+	// aliasMirror renames like aliasRename and renames the aliases that were the same as the old name to the new name
+	aliasMirror = "mirror"
+)
+
+// Errors returned for invalid options.
+var (
+	ErrInvalidName  = fmt.Errorf("invalid package name")
+	ErrAliasPattern = fmt.Errorf("invalid alias pattern")
+	ErrAliasPolicy  = fmt.Errorf("invalid alias policy")
+)
+
+// packageNameFor returns the name a package with the given import path is expected to have, the name importers use
+// without an alias. Like for the go command, it's the last element of the path without its major version suffix,
+// so both example.com/lib/v3 and gopkg.in/lib.v3 are expected to be package lib. Characters that can't be part of an
+// identifier are dropped, and names that still aren't valid, like keywords or names starting with a digit, get a pkg
+// prefix.
+func packageNameFor(importPath string) string {
+	base := path.Base(importPath)
+
+	if isMajorVersion(base) && path.Dir(importPath) != "." {
+		base = path.Base(path.Dir(importPath))
+	}
+
+	if i := strings.LastIndex(base, "."); i > 0 && isMajorVersion(base[i+1:]) {
+		base = base[:i]
+	}
+
+	name := strings.Map(func(r rune) rune {
+		if r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+
+		return -1
+	}, base)
+
+	if name == "" || name == "_" || token.IsKeyword(name) || unicode.IsDigit([]rune(name)[0]) {
+		return "pkg" + name
+	}
+
+	return name
+}
+
+// isMajorVersion reports whether s is a major version suffix, like v2.
+func isMajorVersion(s string) bool {
+	if len(s) < 2 || s[0] != 'v' || s[1] == '0' {
+		return false
+	}
+
+	for _, r := range s[1:] {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// checkPackageName returns an error if name can't be used as the name of a package.
+func checkPackageName(name string) error {
+	if !token.IsIdentifier(name) || name == "_" {
+		return fmt.Errorf("%w: %q", ErrInvalidName, name)
+	}
+
+	return nil
+}
+
+// checkAliasPattern returns an error if pattern can't produce a distinct valid identifier for every counter value.
+func checkAliasPattern(pattern string) error {
+	if !strings.Contains(pattern, "{n}") || checkPackageName(expandAliasPattern(pattern, "name", 2)) != nil {
+		return fmt.Errorf("%w: %q, it needs {n} and must produce identifiers", ErrAliasPattern, pattern)
+	}
+
+	return nil
+}
+
+// setAliasPattern sets the pattern of the aliases given to imports whose name is already taken, or the default one if
+// pattern is empty.
+func (p *pkgMover) setAliasPattern(pattern string) error {
+	if pattern == "" {
+		return nil
+	}
+
+	err := checkAliasPattern(pattern)
+	if err != nil {
+		return err
+	}
+
+	p.aliasPattern = pattern
+
+	return nil
+}
+
+// setAliasPolicy sets the policy deciding what happens to the imports of a renamed package, or the default one if
+// policy is empty.
+func (p *pkgMover) setAliasPolicy(policy string) error {
+	switch policy {
+	case "":
+	case aliasRename, aliasKeepName, aliasDropRedundant, aliasMirror:
+		p.aliasPolicy = policy
+	default:
+		return fmt.Errorf("%w: %q, use %s, %s, %s or %s", ErrAliasPolicy, policy, aliasRename, aliasKeepName, aliasDropRedundant, aliasMirror)
+	}
+
+	return nil
+}
+
+// renameImport updates an import of a package renamed from from to to, following the alias policy. The import path
+// has already been rewritten to pkgPath, while the type information still refers to the package by oldPkgPath.
+// It returns the number of references to the package that were renamed or qualified.
+func (p *pkgMover) renameImport(loaded *loadedFile, imp *ast.ImportSpec, oldPkgPath, pkgPath, from, to string) (int, error) {
+	switch {
+	case imp.Name != nil && imp.Name.Name == ".":
+		return p.fixDotImport(loaded, imp, oldPkgPath, pkgPath, to)
+	case imp.Name == nil && p.aliasPolicy == aliasKeepName:
+		// the references keep using the old name
+		aliasImport(loaded.file, pkgPath, to, from)
+	case imp.Name == nil:
+		// the new name may be taken by another import or captured by a declaration in scope at a reference
+		refs := packageRefs(loaded, oldPkgPath, from)
+		name := p.availableImportName(loaded, pkgPath, to, refs)
+
+		// importers need an alias when the package isn't named after the last element of its import path
+		aliasImport(loaded.file, pkgPath, to, name)
+
+		return renameRefs(refs, name), nil
+	case p.aliasPolicy == aliasDropRedundant && imp.Name.Name == to && !needsAlias(pkgPath, to, to):
+		imp.Name = nil
+	case p.aliasPolicy == aliasMirror && imp.Name.Name == from:
+		refs := packageRefs(loaded, oldPkgPath, from)
+		name := p.availableImportName(loaded, pkgPath, to, refs)
+
+		imp.Name.Name = name
+
+		return renameRefs(refs, name), nil
+	}
+
+	return 0, nil
+}
+
+// packageRefs returns the identifiers the file refers to the package with the given path by, under the given name.
+func packageRefs(loaded *loadedFile, pkgPath, name string) []*ast.Ident {
+	refs := []*ast.Ident{}
+
+	ast.Inspect(loaded.file, func(node ast.Node) bool {
+		selExpr, ok := node.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+
+		ident, ok := selExpr.X.(*ast.Ident)
+		if ok && ident.Name == name && refersToPackage(loaded.info, ident, pkgPath) {
+			refs = append(refs, ident)
+		}
+
+		return true
+	})
+
+	return refs
+}
+
+// renameRefs renames the given references to a package in place, so that the type information keeps pointing at them.
+// It returns the number of references whose name changed.
+func renameRefs(refs []*ast.Ident, name string) int {
+	renamed := 0
+
+	for _, ident := range refs {
+		if ident.Name != name {
+			ident.Name = name
+			renamed++
+		}
+	}
+
+	return renamed
+}
+
+// expandAliasPattern returns the alias the pattern produces for the package name and counter value.
+func expandAliasPattern(pattern, name string, n int) string {
+	return strings.NewReplacer("{name}", name, "{n}", strconv.Itoa(n)).Replace(pattern)
+}
+
+// importedNames returns the names the file refers to its imports by, except for the imports of the package with the
+// given path, blank imports and dot imports.
+func (p *pkgMover) importedNames(loaded *loadedFile, except string) map[string]struct{} {
+	names := map[string]struct{}{}
+
+	for _, imp := range loaded.file.Imports {
+		importPath, err := importPathOf(imp.Path.Value)
+		if err != nil || importPath == except {
+			continue
+		}
+
+		name := p.pkgName(importPath)
+
+		switch obj, ok := loaded.info.Implicits[imp]; {
+		case imp.Name != nil:
+			name = imp.Name.Name
+		case ok:
+			name = obj.Name()
+		}
+
+		if name != "_" && name != "." {
+			names[name] = struct{}{}
+		}
+	}
+
+	return names
+}
+
+// availableImportName returns the name the file can refer to the package with the given path by at the given
+// references: name, unless another import already uses it or a declaration would capture one of the references, in
+// which case an alias following the alias pattern is chosen and reported.
+func (p *pkgMover) availableImportName(loaded *loadedFile, pkgPath, name string, refs []*ast.Ident) string {
+	taken := p.importedNames(loaded, pkgPath)
+	if !nameTaken(loaded, name, taken, refs) {
+		return name
+	}
+
+	for n := 2; ; n++ {
+		alias := expandAliasPattern(p.aliasPattern, name, n)
+		if !nameTaken(loaded, alias, taken, refs) {
+			p.aliases = append(p.aliases, importAlias{filename: p.fset.Position(loaded.file.Package).Filename, pkgPath: pkgPath, name: name, alias: alias})
+
+			return alias
+		}
+	}
+}
+
+// nameTaken reports whether an import can't be referred to by name in the file, because another import uses it, a
+// package level declaration has it or a local declaration in scope at one of the references has it.
+func nameTaken(loaded *loadedFile, name string, imported map[string]struct{}, refs []*ast.Ident) bool {
+	if _, ok := imported[name]; ok {
+		return true
+	}
+
+	fileScope := loaded.info.Scopes[loaded.file]
+	if fileScope == nil {
+		// without type information, any identifier with the same name may be a declaration capturing the references
+		return declaresName(loaded.file, name, refs)
+	}
+
+	if fileScope.Parent().Lookup(name) != nil {
+		return true
+	}
+
+	for _, ref := range refs {
+		scope := fileScope.Innermost(ref.Pos())
+		if scope == nil {
+			continue
+		}
+
+		if _, obj := scope.LookupParent(name, ref.Pos()); obj != nil && obj != loaded.info.Uses[ref] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// declaresName reports whether the file has an identifier with the given name other than the given references and its
+// package clause.
+func declaresName(file *ast.File, name string, refs []*ast.Ident) bool {
+	found := false
+
+	ast.Inspect(file, func(n ast.Node) bool {
+		ident, ok := n.(*ast.Ident)
+		if !ok || ident.Name != name || ident == file.Name || found {
+			return !found
+		}
+
+		for _, ref := range refs {
+			if ref == ident {
+				return true
+			}
+		}
+
+		found = true
+
+		return false
+	})
+
+	return found
+}
+
+// addImport imports the package with the given path and name in the file, with an alias if the name isn't the one
+// importers expect from the path or if it's already taken at the given references. It returns the name the file refers
+// to the package by.
+func (p *pkgMover) addImport(loaded *loadedFile, pkgPath, pkgName string, refs []*ast.Ident) string {
+	name := p.availableImportName(loaded, pkgPath, pkgName, refs)
+
+	if !needsAlias(pkgPath, pkgName, name) {
+		astutil.AddImport(p.fset, loaded.file, pkgPath)
+	} else {
+		astutil.AddNamedImport(p.fset, loaded.file, name, pkgPath)
+	}
+
+	return name
+}
+
+// importAlias is an alias given to an import because its name was already taken in the file.
+type importAlias struct {
+	filename string
+	pkgPath  string
+	name     string
+	alias    string
+}
+
+// reportAliases lists the aliases given to imports whose name was already taken.
+func (p *pkgMover) reportAliases() {
+	for _, a := range p.aliases {
+		p.warn("imported %s as %s in %s, %s was already taken\n", a.pkgPath, a.alias, p.reportPath(p.getFilePath(a.filename)), a.name)
+	}
+}
+
+// aliasImport adds an alias to the unaliased imports of the package with the given path and name in the file if the
+// file needs to refer to it by another name.
+func aliasImport(file *ast.File, pkgPath, pkgName, name string) {
+	if !needsAlias(pkgPath, pkgName, name) {
+		return
+	}
+
+	for _, imp := range file.Imports {
+		if imp.Name == nil && imp.Path.Value == fmt.Sprintf("%q", pkgPath) {
+			imp.Name = &ast.Ident{NamePos: imp.Path.Pos(), Name: name}
+		}
+	}
+}
+
+// needsAlias reports whether an import of the package with the given path and name needs an alias for the file to
+// refer to it by name. The alias is left out only when both names are the last element of the path, so that readers
+// and tools don't have to guess the name from a path like my-lib/v3.
+func needsAlias(pkgPath, pkgName, name string) bool {
+	return name != pkgName || name != path.Base(pkgPath)
+}
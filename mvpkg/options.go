@@ -0,0 +1,172 @@
+package mvpkg
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+)
+
+// The commands Options can describe.
+const (
+	CommandMove          = "move"
+	CommandMerge         = "merge"
+	CommandDecl          = "decl"
+	CommandSplit         = "split"
+	CommandExtractModule = "extract-module"
+	CommandMergeModule   = "merge-module"
+)
+
+// ErrUnknownCommand is returned for an Options.Command that isn't one of the Command constants.
+var ErrUnknownCommand = fmt.Errorf("unknown command")
+
+// Logger receives the status of a command while it runs, *log.Logger is one.
+type Logger interface {
+	Printf(format string, args ...interface{})
+}
+
+// LoggerFunc turns a printf-like function, like the Logf method of testing.T, into a Logger.
+type LoggerFunc func(format string, args ...interface{})
+
+// Printf calls f.
+func (f LoggerFunc) Printf(format string, args ...interface{}) {
+	f(format, args...)
+}
+
+// Options describes a command and its arguments. Paths are relative to the root of the module containing Pwd.
+// Imports whose name is already taken in a file get an alias following AliasPattern, {name}{n} by default.
+type Options struct {
+	// Command is one of the Command constants, CommandMove if it's empty
+	Command string `json:"command"`
+	Pwd     string `json:"pwd"`
+	// Src is the source package, or the directory of the module for CommandExtractModule and CommandMergeModule
+	Src string `json:"src"`
+	Dst string `json:"dst,omitempty"`
+	// Name is the name of the destination package of a move or a split
+	Name string `json:"name,omitempty"`
+	// Decl is the name of the declaration moved by CommandDecl
+	Decl string `json:"decl,omitempty"`
+	// Files is the pattern matching the names of the files moved by CommandSplit
+	Files string `json:"files,omitempty"`
+	// ModulePath is the module path of the module created by CommandExtractModule
+	ModulePath        string   `json:"module_path,omitempty"`
+	AliasPattern      string   `json:"alias_pattern,omitempty"`
+	AliasPolicy       string   `json:"alias_policy,omitempty"`
+	BuildFlags        []string `json:"build_flags,omitempty"`
+	Recursive         bool     `json:"recursive,omitempty"`
+	QualifyDotImports bool     `json:"qualify_dot_imports,omitempty"`
+	Forward           bool     `json:"forward,omitempty"`
+	Export            bool     `json:"export,omitempty"`
+	// Logger receives the status while the command runs, it's optional
+	Logger Logger `json:"-"`
+	// DryRun only logs the planned actions
+	DryRun bool `json:"-"`
+	// Diff receives the changes as a patch that git apply accepts if it's set, and the tree is left as it was. The
+	// changes are still made on disk and rolled back once recorded, so the modules must be writable.
+	Diff io.Writer `json:"-"`
+	// JSON receives a JSON description of the changes and the outcome once done if it's set
+	JSON io.Writer `json:"-"`
+}
+
+// Result describes the changes made to the tree. Paths are relative to Root, the root of the repository containing the
+// main module, or of the main module outside of a repository. A file that's moved and rewritten is only listed in
+// Moved.
+type Result struct {
+	Root      string   `json:"root"`
+	Moved     []Change `json:"moved"`
+	Rewritten []string `json:"rewritten"`
+	Created   []string `json:"created"`
+	Removed   []string `json:"removed"`
+	Warnings  []string `json:"warnings"`
+}
+
+// Run runs the command described by opts and returns the changes it made, which are none with DryRun or Diff.
+// If the command fails part way through or ctx is cancelled, all changes made to the filesystem are rolled back.
+func Run(ctx context.Context, opts Options) (result *Result, err error) {
+	printf := opts.printf()
+	start := time.Now()
+
+	defer func() {
+		printf("done in %s\n", time.Since(start))
+	}()
+
+	mover := newPkgMover(printf, opts.Diff, opts.JSON, opts.DryRun)
+	mover.ctx = ctx
+
+	defer mover.writeReport(&err)
+
+	err = mover.run(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return mover.result(mover.repoRoot(), mover.report.Warnings)
+}
+
+func (opts Options) printf() func(s string, args ...interface{}) {
+	if opts.Logger == nil {
+		return func(s string, args ...interface{}) {}
+	}
+
+	return opts.Logger.Printf
+}
+
+// result describes the changes recorded in the journal, with paths relative to root. It must be called before the
+// changes are rolled back, since the journal is emptied then.
+func (p *pkgMover) result(root string, warnings []string) (*Result, error) {
+	result := &Result{Root: root, Moved: []Change{}, Rewritten: []string{}, Created: []string{}, Removed: []string{}, Warnings: warnings}
+
+	for _, c := range journalChanges(p.journal.entries) {
+		oldData, newData, err := c.contents()
+		if err != nil {
+			return nil, err
+		}
+
+		if c.unchanged(oldData, newData) {
+			continue
+		}
+
+		oldPath, newPath, err := c.planPaths(root)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case oldPath == "":
+			result.Created = append(result.Created, newPath)
+		case newPath == "":
+			result.Removed = append(result.Removed, oldPath)
+		case oldPath != newPath:
+			result.Moved = append(result.Moved, Change{OldPath: oldPath, NewPath: newPath})
+		default:
+			result.Rewritten = append(result.Rewritten, newPath)
+		}
+	}
+
+	return result, nil
+}
+
+// run runs the command described by opts. What happens to the changes once they're made is up to the mover.
+func (p *pkgMover) run(opts Options) error {
+	err := p.ctx.Err()
+	if err != nil {
+		return err
+	}
+
+	switch opts.Command {
+	case CommandMove, "":
+		return p.runMove(opts)
+	case CommandMerge:
+		return p.runMerge(opts)
+	case CommandDecl:
+		return p.runDecl(opts)
+	case CommandSplit:
+		return p.runSplit(opts)
+	case CommandExtractModule:
+		return p.runExtractModule(opts)
+	case CommandMergeModule:
+		return p.runMergeModule(opts)
+	default:
+		return fmt.Errorf("%w: %q", ErrUnknownCommand, opts.Command)
+	}
+}
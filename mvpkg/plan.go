@@ -0,0 +1,331 @@
+package mvpkg
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Errors returned by NewPlan and Apply.
+var (
+	ErrPlanStale   = fmt.Errorf("files changed since the plan was made")
+	ErrPlanInvalid = fmt.Errorf("invalid plan")
+)
+
+// Plan is the set of changes a command makes to the tree, computed without leaving any changes behind so that it can
+// be reviewed, edited and applied later, possibly in another clone of the repository. Paths, including Options.Pwd,
+// are relative to the root of the repository containing the main module, or of the main module outside of a
+// repository.
+type Plan struct {
+	Options  Options  `json:"options"`
+	Warnings []string `json:"warnings"`
+	Changes  []Change `json:"changes"`
+	// Inputs holds the sha256 of every file the plan was computed from, the plan can't be applied once any of them
+	// changed
+	Inputs map[string]string `json:"inputs"`
+}
+
+// Change is a change made to a single file: it's moved from OldPath to NewPath and its contents are replaced by
+// Contents if it's set. OldPath is empty for a new file and NewPath is empty for a removed file.
+type Change struct {
+	OldPath  string  `json:"old_path,omitempty"`
+	NewPath  string  `json:"new_path,omitempty"`
+	Contents *string `json:"contents,omitempty"`
+}
+
+// NewPlan computes the changes the command described by opts makes. The command runs for real and its changes are
+// rolled back once they're recorded, so the plan is exactly what running the command would do, but the modules must
+// be writable: ErrNotWritable is returned otherwise. DryRun, Diff and JSON are ignored.
+func NewPlan(ctx context.Context, opts Options) (*Plan, error) {
+	mover := newPkgMover(opts.printf(), nil, nil, false)
+	mover.ctx = ctx
+	mover.plan = &Plan{Options: opts}
+
+	err := mover.run(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return mover.plan, nil
+}
+
+// recordPlan records the changes in the journal in the plan. It must be called before the changes are rolled back,
+// since the new contents of the files are read from disk.
+func (p *pkgMover) recordPlan() error {
+	root := p.repoRoot()
+
+	pwd, err := filepath.Abs(p.plan.Options.Pwd)
+	if err != nil {
+		return fmt.Errorf("failed to make %s absolute: %w", p.plan.Options.Pwd, err)
+	}
+
+	p.plan.Options.Pwd, err = relativePath(root, pwd)
+	if err != nil {
+		return err
+	}
+
+	p.plan.Warnings = p.report.Warnings
+	p.plan.Changes = []Change{}
+
+	for _, c := range journalChanges(p.journal.entries) {
+		oldData, newData, err := c.contents()
+		if err != nil {
+			return err
+		}
+
+		if c.unchanged(oldData, newData) {
+			continue
+		}
+
+		oldPath, newPath, err := c.planPaths(root)
+		if err != nil {
+			return err
+		}
+
+		change := Change{OldPath: oldPath, NewPath: newPath}
+
+		if newPath != "" && (oldPath == "" || !bytes.Equal(oldData, newData)) {
+			if !utf8.Valid(newData) {
+				return fmt.Errorf("%w: the contents of %s aren't text", ErrPlanInvalid, newPath)
+			}
+
+			contents := string(newData)
+			change.Contents = &contents
+		}
+
+		p.plan.Changes = append(p.plan.Changes, change)
+	}
+
+	return nil
+}
+
+// planPaths returns the old and new paths of the change relative to root, empty for the sides that don't exist.
+func (c *fileChange) planPaths(root string) (string, string, error) {
+	paths := [2]string{}
+
+	for i, filePath := range []string{c.oldPath, c.newPath} {
+		if filePath == "" {
+			continue
+		}
+
+		var err error
+
+		paths[i], err = relativePath(root, filePath)
+		if err != nil {
+			return "", "", err
+		}
+	}
+
+	return paths[0], paths[1], nil
+}
+
+// hashInputs records the hashes of the files the plan was computed from: the loaded Go files, the go.mod, go.sum and
+// go.work files and every file the plan changes. It must be called once the changes are rolled back.
+func (p *pkgMover) hashInputs() error {
+	root := p.repoRoot()
+	inputs := map[string]struct{}{}
+
+	for filename := range p.files {
+		inputs[filename] = struct{}{}
+	}
+
+	for _, m := range p.modules {
+		inputs[filepath.Join(m.dir, "go.mod")] = struct{}{}
+		inputs[filepath.Join(m.dir, "go.sum")] = struct{}{}
+	}
+
+	if p.workFile != "" {
+		inputs[p.workFile] = struct{}{}
+	}
+
+	for _, c := range p.plan.Changes {
+		if c.OldPath != "" {
+			inputs[filepath.Join(root, filepath.FromSlash(c.OldPath))] = struct{}{}
+		}
+	}
+
+	p.plan.Inputs = map[string]string{}
+
+	for filename := range inputs {
+		rel, err := relativePath(root, filename)
+		// the loaded packages include files generated in the build cache, which aren't inputs of the plan
+		if err != nil || !filepath.IsLocal(filepath.FromSlash(rel)) {
+			continue
+		}
+
+		_, exists, err := readIfExists(filename)
+		if err != nil {
+			return err
+		}
+
+		if !exists {
+			continue
+		}
+
+		p.plan.Inputs[rel], err = hashFile(filename)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Apply applies the changes of the plan to the repository containing pwd, or to the module containing pwd outside of
+// a repository, once it made sure that none of the files the plan was computed from changed since. The changes are
+// saved to the undo journal like the changes of any other command.
+// If applying the plan fails part way through or ctx is cancelled, all changes made to the filesystem are rolled back.
+func Apply(ctx context.Context, plan *Plan, pwd string) (*Result, error) {
+	mover := newPkgMover(plan.Options.printf(), nil, nil, false)
+	mover.ctx = ctx
+
+	err := ctx.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	err = mover.init(pwd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize mover: %w", err)
+	}
+
+	root := mover.repoRoot()
+
+	err = plan.check(root)
+	if err != nil {
+		return nil, err
+	}
+
+	return mover.apply(plan, root)
+}
+
+// check makes sure that the inputs of the plan haven't changed and that its changes stay inside root without
+// overwriting any file.
+func (plan *Plan) check(root string) error {
+	stale := []string{}
+
+	for rel, hash := range plan.Inputs {
+		current, err := hashFile(planPath(root, rel))
+		if err != nil || current != hash {
+			stale = append(stale, rel)
+		}
+	}
+
+	if len(stale) > 0 {
+		sort.Strings(stale)
+
+		return fmt.Errorf("%w: %s", ErrPlanStale, strings.Join(stale, ", "))
+	}
+
+	for _, c := range plan.Changes {
+		for _, rel := range []string{c.OldPath, c.NewPath} {
+			if rel != "" && !filepath.IsLocal(filepath.FromSlash(rel)) {
+				return fmt.Errorf("%w: %s is outside of %s", ErrPlanInvalid, rel, root)
+			}
+		}
+
+		switch {
+		case c.OldPath == "" && c.NewPath == "":
+			return fmt.Errorf("%w: a change has neither an old nor a new path", ErrPlanInvalid)
+		case c.OldPath != "" && plan.Inputs[c.OldPath] == "":
+			// only the files whose hashes were checked can be changed
+			return fmt.Errorf("%w: %s isn't one of the inputs", ErrPlanInvalid, c.OldPath)
+		}
+
+		if c.NewPath == "" || c.NewPath == c.OldPath {
+			continue
+		}
+
+		_, exists, err := readIfExists(planPath(root, c.NewPath))
+		if err != nil {
+			return err
+		}
+
+		if exists {
+			return fmt.Errorf("%w: it would overwrite %s", ErrPlanInvalid, c.NewPath)
+		}
+	}
+
+	return nil
+}
+
+// planPath returns the absolute path of a path of a plan applied to root.
+func planPath(root, rel string) string {
+	return filepath.Join(root, filepath.FromSlash(rel))
+}
+
+// apply makes the changes of the plan to root through the journal and saves it so that they can be undone.
+func (p *pkgMover) apply(plan *Plan, root string) (result *Result, err error) {
+	defer p.rollbackOnError(&err)
+
+	// the directories left empty by the moved and removed files are pruned, up to root
+	emptied := map[string]struct{}{}
+
+	for _, c := range plan.Changes {
+		err = p.ctx.Err()
+		if err != nil {
+			return nil, err
+		}
+
+		oldPath, newPath := planPath(root, c.OldPath), planPath(root, c.NewPath)
+
+		switch {
+		case c.OldPath == "":
+			err = p.applyContents(newPath, c.Contents)
+		case c.NewPath == "":
+			p.log("removing %s\n", oldPath)
+
+			err = p.journal.remove(oldPath)
+		case c.OldPath != c.NewPath:
+			err = p.moveFile(oldPath, newPath)
+			if err == nil && c.Contents != nil {
+				err = p.applyContents(newPath, c.Contents)
+			}
+		case c.Contents != nil:
+			err = p.applyContents(newPath, c.Contents)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if c.OldPath != "" && c.NewPath != c.OldPath {
+			for dir := filepath.Dir(oldPath); dir != root && strings.HasPrefix(dir, root); dir = filepath.Dir(dir) {
+				emptied[dir] = struct{}{}
+			}
+		}
+	}
+
+	err = p.pruneEmptyDirs(emptied)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err = p.result(root, plan.Warnings)
+	if err != nil {
+		return nil, err
+	}
+
+	p.saveJournal()
+
+	return result, nil
+}
+
+// applyContents writes the contents of a change to filename, creating the directories it needs.
+func (p *pkgMover) applyContents(filename string, contents *string) error {
+	err := p.journal.mkdirAll(filepath.Dir(filename))
+	if err != nil {
+		return fmt.Errorf("error creating directory %s: %w", filepath.Dir(filename), err)
+	}
+
+	data := []byte{}
+	if contents != nil {
+		data = []byte(*contents)
+	}
+
+	return p.writeFile(filename, data)
+}
@@ -0,0 +1,114 @@
+package mvpkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// report is the machine readable description of what a command did, or would do in a dry run. Paths are relative to
+// the root of the main module.
+type report struct {
+	ModuleDir string           `json:"module_dir"`
+	DryRun    bool             `json:"dry_run"`
+	Pairs     []reportPair     `json:"pairs"`
+	Moves     []reportMove     `json:"moves"`
+	Rewrites  []*reportRewrite `json:"rewrites"`
+	Warnings  []string         `json:"warnings"`
+	Result    reportResult     `json:"result"`
+}
+
+// reportPair is a package moved from one directory and import path to another.
+type reportPair struct {
+	Src        string `json:"src"`
+	Dst        string `json:"dst"`
+	SrcPkgPath string `json:"src_pkg_path"`
+	DstPkgPath string `json:"dst_pkg_path"`
+}
+
+// reportMove is a file moved from one path to another.
+type reportMove struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// reportRewrite is a file rewritten in place, with the number of selectors renamed because the package they refer to
+// was renamed or merged.
+type reportRewrite struct {
+	File             string `json:"file"`
+	RenamedSelectors int    `json:"renamed_selectors"`
+}
+
+// reportResult tells whether the command succeeded.
+type reportResult struct {
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+// reportPath returns filename relative to the root of the main module.
+func (p *pkgMover) reportPath(filename string) string {
+	rel, err := relativePath(p.moduleDir, filename)
+	if err != nil {
+		return filename
+	}
+
+	return rel
+}
+
+// recordPairs records the packages about to move.
+func (p *pkgMover) recordPairs(mPairs []movePair) {
+	for _, mPair := range mPairs {
+		p.report.Pairs = append(p.report.Pairs, reportPair{
+			Src:        mPair.src,
+			Dst:        mPair.dst,
+			SrcPkgPath: mPair.srcPkgPath,
+			DstPkgPath: mPair.dstPkgPath,
+		})
+	}
+}
+
+// recordRewrite records that filename is rewritten, along with the number of selectors renamed in it.
+func (p *pkgMover) recordRewrite(filename string, renamed int) {
+	file := p.reportPath(filename)
+
+	for _, r := range p.report.Rewrites {
+		if r.File == file {
+			r.RenamedSelectors += renamed
+
+			return
+		}
+	}
+
+	p.report.Rewrites = append(p.report.Rewrites, &reportRewrite{File: file, RenamedSelectors: renamed})
+}
+
+// warn logs a message that's worth a second look and records it in the report.
+func (p *pkgMover) warn(s string, args ...interface{}) {
+	p.log(s, args...)
+	p.report.Warnings = append(p.report.Warnings, strings.TrimSuffix(fmt.Sprintf(s, args...), "\n"))
+}
+
+// writeReport writes the report as JSON along with the outcome of the command, if asked to. It's meant to be deferred
+// before anything else, so that *err is final by the time it runs.
+func (p *pkgMover) writeReport(err *error) {
+	if p.jsonOut == nil {
+		return
+	}
+
+	p.report.ModuleDir = p.moduleDir
+	p.report.DryRun = p.dryRun
+	p.report.Result = reportResult{Success: *err == nil}
+
+	if *err != nil {
+		p.report.Result.Error = (*err).Error()
+	}
+
+	data, marshalErr := json.MarshalIndent(p.report, "", "  ")
+	if marshalErr == nil {
+		_, marshalErr = p.jsonOut.Write(append(data, '\n'))
+	}
+
+	if marshalErr != nil && *err == nil {
+		*err = fmt.Errorf("failed to write the report: %w", marshalErr)
+	}
+}
@@ -0,0 +1,473 @@
+package mvpkg
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Errors returned by CommandSplit.
+var (
+	ErrSplitNoFiles    = fmt.Errorf("no files of the package match the pattern")
+	ErrSplitAllFiles   = fmt.Errorf("every file of the package matches the pattern, use a regular move")
+	ErrSplitUnexported = fmt.Errorf("unexported identifiers would be referenced across the new package boundary, use -export to export them")
+	ErrSplitMethods    = fmt.Errorf("methods must be declared in the same package as their types")
+	ErrSplitCycle      = fmt.Errorf("splitting the package would create an import cycle")
+	ErrSplitExport     = fmt.Errorf("can't export identifier")
+	ErrSplitEmbed      = fmt.Errorf("files embedding other files can't be split off, the embedded files may be shared")
+)
+
+// pkgSplit is a package being split by moving some of its files to a new package.
+type pkgSplit struct {
+	mPair movePair
+	// moved holds the files being moved
+	moved map[string]bool
+	// changed holds the files whose syntax trees were changed and need to be written back
+	changed map[string]struct{}
+}
+
+// crossingRef is an unexported identifier referenced from the other side of the new package boundary.
+type crossingRef struct {
+	name     string
+	declared string
+	usedIn   map[string]struct{}
+	// obj is the object the identifier resolves to in one of the type checked variants of the package
+	obj types.Object
+}
+
+// runSplit runs CommandSplit: it moves the files of the package at opts.Src whose names match opts.Files to a new
+// package at opts.Dst. References between the files that move and the files that stay become qualified, and importers
+// of the package refer to the moved declarations through the new package.
+// Unexported identifiers referenced across the new package boundary are reported, or exported if opts.Export is set.
+// The new package is called opts.Name, or a name derived from its import path if it's empty.
+func (p *pkgMover) runSplit(opts Options) (err error) {
+	if opts.Name != "" {
+		err = checkPackageName(opts.Name)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = p.setAliasPattern(opts.AliasPattern)
+	if err != nil {
+		return err
+	}
+
+	err = p.init(opts.Pwd)
+	if err != nil {
+		return fmt.Errorf("failed to initialize mover: %w", err)
+	}
+
+	mPairs := []movePair{{src: filepath.Clean(opts.Src), dst: filepath.Clean(opts.Dst), name: opts.Name}}
+
+	err = p.resolvePairs(mPairs)
+	if err != nil {
+		return fmt.Errorf("failed to find modules: %w", err)
+	}
+
+	err = p.load(opts.BuildFlags)
+	if err != nil {
+		return fmt.Errorf("failed to initialize mover: %w", err)
+	}
+
+	s, err := p.splitFiles(mPairs[0], opts.Files)
+	if err != nil {
+		return err
+	}
+
+	// only the files matching the pattern may collide with files in the destination
+	err = p.checkDestinations([]movePair{s.mPair})
+	if err != nil {
+		return err
+	}
+
+	err = p.checkSplitMethods(s)
+	if err != nil {
+		return err
+	}
+
+	crossing := p.crossingReferences(s)
+	if len(crossing) > 0 && !opts.Export {
+		refs := make([]string, 0, len(crossing))
+		for _, ref := range crossing {
+			refs = append(refs, ref.String())
+		}
+
+		return fmt.Errorf("%w: %s", ErrSplitUnexported, strings.Join(refs, ", "))
+	}
+
+	// the crossing identifiers are only exported in the syntax trees, no file is written before the cycle check passed
+	for _, ref := range crossing {
+		err = p.exportIdentifier(s, ref)
+		if err != nil {
+			return err
+		}
+	}
+
+	p.requalifySplit(s)
+
+	err = p.checkSplitCycles(s)
+	if err != nil {
+		return err
+	}
+
+	defer p.rollbackOnError(&err)
+
+	p.recordPairs([]movePair{s.mPair})
+
+	err = p.move(s.mPair)
+	if err != nil {
+		return err
+	}
+
+	err = p.writeChanged(s.changed)
+	if err != nil {
+		return err
+	}
+
+	err = p.fixGoMods()
+	if err != nil {
+		return fmt.Errorf("failed to update go.mod files: %w", err)
+	}
+
+	p.reportAliases()
+
+	return p.finish()
+}
+
+// splitFiles selects the files of the source package whose names match pattern.
+func (p *pkgMover) splitFiles(mPair movePair, pattern string) (*pkgSplit, error) {
+	s := &pkgSplit{mPair: mPair, moved: map[string]bool{}, changed: map[string]struct{}{}}
+	srcFiles := p.directoryFiles(mPair.srcPkgPath)
+
+	for _, filename := range srcFiles {
+		matched, err := filepath.Match(pattern, filepath.Base(filename))
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %s: %w", pattern, err)
+		}
+
+		if matched && embeds(p.files[filename]) {
+			return nil, fmt.Errorf("%w: %s", ErrSplitEmbed, filename)
+		}
+
+		if matched {
+			s.moved[filename] = true
+			s.mPair.files = append(s.mPair.files, filename)
+		}
+	}
+
+	switch len(s.moved) {
+	case 0:
+		return nil, fmt.Errorf("%w: %s in %s", ErrSplitNoFiles, pattern, mPair.src)
+	case len(srcFiles):
+		return nil, fmt.Errorf("%w: %s in %s", ErrSplitAllFiles, pattern, mPair.src)
+	}
+
+	return s, nil
+}
+
+// embeds returns true if the file has //go:embed directives.
+func embeds(loaded *loadedFile) bool {
+	if loaded == nil {
+		return false
+	}
+
+	for _, group := range loaded.file.Comments {
+		for _, comment := range group.List {
+			if strings.HasPrefix(comment.Text, "//go:embed ") {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// declaredIn returns the file the object is declared in.
+func (p *pkgMover) declaredIn(obj types.Object) string {
+	return p.fset.Position(obj.Pos()).Filename
+}
+
+// inPackage returns true if the object is declared in the source package, not counting its external tests.
+func (s *pkgSplit) inPackage(obj types.Object) bool {
+	return obj != nil && obj.Pkg() != nil && obj.Pkg().Path() == s.mPair.srcPkgPath
+}
+
+// isMoved returns a function matching the package level objects that are declared on the given side of the split.
+func (p *pkgMover) isMoved(s *pkgSplit, moved bool) func(types.Object) bool {
+	return func(obj types.Object) bool {
+		return s.inPackage(obj) && obj.Parent() == obj.Pkg().Scope() && s.moved[p.declaredIn(obj)] == moved
+	}
+}
+
+// checkSplitMethods makes sure that no method ends up in a different package than its receiver type.
+func (p *pkgMover) checkSplitMethods(s *pkgSplit) error {
+	split := []string{}
+
+	for _, filename := range p.packageFiles(s.mPair.srcPkgPath) {
+		loaded, ok := p.files[filename]
+		if !ok || loaded.pkgPath != s.mPair.srcPkgPath {
+			continue
+		}
+
+		for _, decl := range loaded.file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Recv == nil {
+				continue
+			}
+
+			obj := loaded.info.Defs[fn.Name]
+			if obj == nil {
+				continue
+			}
+
+			recv := obj.Type().(*types.Signature).Recv().Type()
+			if ptr, ok := recv.(*types.Pointer); ok {
+				recv = ptr.Elem()
+			}
+
+			named, ok := recv.(*types.Named)
+			if !ok || s.moved[p.declaredIn(named.Obj())] == s.moved[filename] {
+				continue
+			}
+
+			split = append(split, fmt.Sprintf("%s.%s in %s", named.Obj().Name(), fn.Name.Name, filepath.Base(filename)))
+		}
+	}
+
+	if len(split) > 0 {
+		sort.Strings(split)
+
+		return fmt.Errorf("%w: %s", ErrSplitMethods, strings.Join(split, ", "))
+	}
+
+	return nil
+}
+
+// objectKey identifies an object across the type checked variants of a package, which have their own objects.
+func (p *pkgMover) objectKey(obj types.Object) string {
+	position := p.fset.Position(obj.Pos())
+
+	return fmt.Sprintf("%s:%d", position.Filename, position.Offset)
+}
+
+// crossingReferences returns the unexported identifiers of the source package that are used on the other side of the
+// new package boundary from where they're declared, sorted by name.
+func (p *pkgMover) crossingReferences(s *pkgSplit) []*crossingRef {
+	refs := map[string]*crossingRef{}
+
+	for _, filename := range p.directoryFiles(s.mPair.srcPkgPath) {
+		loaded, ok := p.files[filename]
+		if !ok || loaded.pkgPath != s.mPair.srcPkgPath {
+			continue
+		}
+
+		ast.Inspect(loaded.file, func(n ast.Node) bool {
+			ident, ok := n.(*ast.Ident)
+			if !ok {
+				return true
+			}
+
+			obj := loaded.info.Uses[ident]
+			if !s.inPackage(obj) || obj.Exported() || s.moved[p.declaredIn(obj)] == s.moved[filename] {
+				return true
+			}
+
+			ref, ok := refs[p.objectKey(obj)]
+			if !ok {
+				ref = &crossingRef{name: obj.Name(), declared: p.declaredIn(obj), usedIn: map[string]struct{}{}, obj: obj}
+				refs[p.objectKey(obj)] = ref
+			}
+
+			ref.usedIn[filename] = struct{}{}
+
+			return true
+		})
+	}
+
+	sorted := make([]*crossingRef, 0, len(refs))
+	for _, ref := range refs {
+		sorted = append(sorted, ref)
+	}
+
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].name != sorted[j].name {
+			return sorted[i].name < sorted[j].name
+		}
+
+		return sorted[i].declared < sorted[j].declared
+	})
+
+	return sorted
+}
+
+func (ref *crossingRef) String() string {
+	usedIn := make([]string, 0, len(ref.usedIn))
+	for filename := range ref.usedIn {
+		usedIn = append(usedIn, filepath.Base(filename))
+	}
+
+	sort.Strings(usedIn)
+
+	return fmt.Sprintf("%s (declared in %s, used in %s)", ref.name, filepath.Base(ref.declared), strings.Join(usedIn, " and "))
+}
+
+// exportIdentifier renames an unexported identifier to its exported form everywhere in the source package.
+func (p *pkgMover) exportIdentifier(s *pkgSplit, ref *crossingRef) error {
+	first, size := utf8.DecodeRuneInString(ref.name)
+	if !unicode.IsLower(first) {
+		return fmt.Errorf("%w: %s doesn't start with a lower case letter", ErrSplitExport, ref.name)
+	}
+
+	exported := string(unicode.ToUpper(first)) + ref.name[size:]
+	obj := ref.obj
+
+	if obj.Parent() == obj.Pkg().Scope() && obj.Pkg().Scope().Lookup(exported) != nil {
+		return fmt.Errorf("%w: %s is already declared in %s", ErrSplitExport, exported, s.mPair.src)
+	}
+
+	if fn, ok := obj.(*types.Func); ok && fn.Type().(*types.Signature).Recv() != nil {
+		if other, _, _ := types.LookupFieldOrMethod(fn.Type().(*types.Signature).Recv().Type(), true, obj.Pkg(), exported); other != nil {
+			return fmt.Errorf("%w: %s already has a field or method %s", ErrSplitExport, ref.name, exported)
+		}
+	}
+
+	p.log("exporting %s as %s\n", ref.name, exported)
+
+	key := p.objectKey(obj)
+
+	for _, filename := range p.directoryFiles(s.mPair.srcPkgPath) {
+		loaded, ok := p.files[filename]
+		if !ok || loaded.pkgPath != s.mPair.srcPkgPath {
+			continue
+		}
+
+		ast.Inspect(loaded.file, func(n ast.Node) bool {
+			ident, ok := n.(*ast.Ident)
+			if !ok {
+				return true
+			}
+
+			obj, ok := loaded.info.Defs[ident]
+			if !ok {
+				obj = loaded.info.Uses[ident]
+			}
+
+			if obj != nil && p.objectKey(obj) == key {
+				ident.Name = exported
+				s.changed[filename] = struct{}{}
+			}
+
+			return true
+		})
+	}
+
+	return nil
+}
+
+// requalifySplit qualifies the references between the files that move and the files that stay, and rewrites the
+// importers of the source package that refer to moved declarations, including the files excluded by the current build
+// configuration. The syntax trees are changed in memory only.
+func (p *pkgMover) requalifySplit(s *pkgSplit) {
+	src, dst := s.mPair.srcPkgPath, s.mPair.dstPkgPath
+	srcName, dstName := p.packageNames(s.mPair)
+	keep := func(ast.Node) bool { return false }
+
+	for _, filename := range p.directoryFiles(src) {
+		loaded, ok := p.files[filename]
+		if !ok || loaded.pkgPath != src {
+			continue
+		}
+
+		changed := false
+		if s.moved[filename] {
+			changed = p.qualifyReferences(loaded, src, srcName, p.isMoved(s, false), keep)
+		} else {
+			changed = p.qualifyReferences(loaded, dst, dstName, p.isMoved(s, true), keep)
+		}
+
+		if changed {
+			ast.SortImports(p.fset, loaded.file)
+			p.warnConstrained(loaded, filename)
+			s.changed[filename] = struct{}{}
+		}
+	}
+
+	importers := p.ignoredImporters(src)
+	for _, pkg := range p.importers(src) {
+		importers = append(importers, pkg.GoFiles...)
+	}
+
+	for _, filename := range importers {
+		loaded, ok := p.files[filename]
+		if !ok || loaded.pkgPath == src {
+			continue
+		}
+
+		if p.requalifyReferences(loaded, src, dst, dstName, p.isMoved(s, true), keep) {
+			p.deleteUnusedImports(loaded, src)
+			ast.SortImports(p.fset, loaded.file)
+			p.warnConstrained(loaded, filename)
+			s.changed[filename] = struct{}{}
+		}
+	}
+}
+
+// checkSplitCycles makes sure that the files that move and the files that stay don't import each other, directly or
+// through other packages.
+func (p *pkgMover) checkSplitCycles(s *pkgSplit) error {
+	srcFiles, dstFiles := []*ast.File{}, []*ast.File{}
+
+	for _, filename := range p.packageFiles(s.mPair.srcPkgPath) {
+		loaded, ok := p.files[filename]
+		if !ok || loaded.pkgPath != s.mPair.srcPkgPath {
+			continue
+		}
+
+		if s.moved[filename] {
+			dstFiles = append(dstFiles, loaded.file)
+		} else {
+			srcFiles = append(srcFiles, loaded.file)
+		}
+	}
+
+	srcImports, err := fileImports(srcFiles)
+	if err != nil {
+		return err
+	}
+
+	dstImports, err := fileImports(dstFiles)
+	if err != nil {
+		return err
+	}
+
+	if p.createsImportCycle(s.mPair.srcPkgPath, s.mPair.dstPkgPath, srcImports, dstImports) {
+		return fmt.Errorf("%w between %s and %s", ErrSplitCycle, s.mPair.src, s.mPair.dst)
+	}
+
+	return nil
+}
+
+// writeChanged writes the syntax trees of the given files back, sorted by name.
+func (p *pkgMover) writeChanged(changed map[string]struct{}) error {
+	filenames := make([]string, 0, len(changed))
+	for filename := range changed {
+		filenames = append(filenames, filename)
+	}
+
+	sort.Strings(filenames)
+
+	for _, filename := range filenames {
+		err := p.writeSyntax(filename)
+		if err != nil {
+			return fmt.Errorf("failed to update %s: %w", filename, err)
+		}
+	}
+
+	return nil
+}
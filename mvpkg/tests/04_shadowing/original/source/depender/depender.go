@@ -0,0 +1,23 @@
+package depender
+
+import (
+	"example.com/source/target"
+)
+
+type T struct {
+	Name string
+}
+
+func (target T) Method() string {
+	return target.Name
+}
+
+func Bar() string {
+	target.Foo()
+
+	f := func(target T) string {
+		return target.Name
+	}
+
+	return f(T{})
+}
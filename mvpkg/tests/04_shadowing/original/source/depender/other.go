@@ -0,0 +1,5 @@
+package depender
+
+func Baz(target T) string {
+	return target.Name
+}
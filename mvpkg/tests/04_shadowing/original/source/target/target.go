@@ -0,0 +1,3 @@
+package target
+
+func Foo() {}
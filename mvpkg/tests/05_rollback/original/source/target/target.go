@@ -0,0 +1,5 @@
+package target
+
+type Foo struct{}
+
+func (f Foo) Hello() {}
@@ -0,0 +1,11 @@
+package depender
+
+import (
+	"fmt"
+
+	"example.com/services/api/target"
+)
+
+func Depend() {
+	fmt.Println(target.Target())
+}
@@ -0,0 +1,7 @@
+module example.com/libs/core
+
+go 1.21
+
+require example.com/services/api v0.0.0-00010101000000-000000000000
+
+replace example.com/services/api => ../../services/api
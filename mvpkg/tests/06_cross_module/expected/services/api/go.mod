@@ -0,0 +1,7 @@
+module example.com/services/api
+
+go 1.21
+
+require example.com/libs/core v0.0.0-00010101000000-000000000000
+
+replace example.com/libs/core => ../../libs/core
@@ -0,0 +1,7 @@
+package target
+
+import "example.com/libs/core/util"
+
+func Target() int {
+	return util.Double(21)
+}
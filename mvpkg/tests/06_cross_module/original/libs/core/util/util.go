@@ -0,0 +1,5 @@
+package util
+
+func Double(i int) int {
+	return i * 2
+}
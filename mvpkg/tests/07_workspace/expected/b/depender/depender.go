@@ -0,0 +1,7 @@
+package depender
+
+import "example.com/a/targetnew"
+
+func Depend() {
+	targetnew.Target()
+}
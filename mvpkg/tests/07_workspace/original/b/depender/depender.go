@@ -0,0 +1,7 @@
+package depender
+
+import "example.com/a/target"
+
+func Depend() {
+	target.Target()
+}
@@ -0,0 +1,10 @@
+module example.com/sdk
+
+go 1.26.0
+
+require (
+	example.com v0.0.0-00010101000000-000000000000
+	golang.org/x/sync v0.23.0
+)
+
+replace example.com => ../..
@@ -0,0 +1,15 @@
+package sdk
+
+import (
+	"example.com/util"
+	"golang.org/x/sync/errgroup"
+)
+
+func Run() error {
+	var g errgroup.Group
+	g.Go(func() error {
+		_ = util.Name()
+		return nil
+	})
+	return g.Wait()
+}
@@ -0,0 +1,5 @@
+package util
+
+func Name() string {
+	return "sdk"
+}
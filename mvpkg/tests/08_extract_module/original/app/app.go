@@ -0,0 +1,7 @@
+package app
+
+import "example.com/pkg/sdk/client"
+
+func App() error {
+	return client.Do()
+}
@@ -0,0 +1,7 @@
+package client
+
+import "example.com/pkg/sdk"
+
+func Do() error {
+	return sdk.Run()
+}
@@ -0,0 +1,7 @@
+package client
+
+import "example.com/lib"
+
+func Do() error {
+	return lib.Run()
+}
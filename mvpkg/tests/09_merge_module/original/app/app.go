@@ -0,0 +1,7 @@
+package app
+
+import "example.org/lib/client"
+
+func App() error {
+	return client.Do()
+}
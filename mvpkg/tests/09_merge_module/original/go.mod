@@ -0,0 +1,9 @@
+module example.com
+
+go 1.26.0
+
+require example.org/lib v0.0.0-00010101000000-000000000000
+
+require golang.org/x/sync v0.23.0 // indirect
+
+replace example.org/lib => ./lib
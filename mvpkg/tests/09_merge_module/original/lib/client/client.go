@@ -0,0 +1,7 @@
+package client
+
+import "example.org/lib"
+
+func Do() error {
+	return lib.Run()
+}
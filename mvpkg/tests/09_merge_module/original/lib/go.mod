@@ -0,0 +1,5 @@
+module example.org/lib
+
+go 1.26.0
+
+require golang.org/x/sync v0.23.0
@@ -0,0 +1,8 @@
+package lib
+
+import "golang.org/x/sync/errgroup"
+
+func Run() error {
+	var g errgroup.Group
+	return g.Wait()
+}
@@ -0,0 +1,9 @@
+package depender
+
+import (
+	"example.com/destination/helpers"
+)
+
+func Depend() string {
+	return helpers.Upper(helpers.Trim(" a "))
+}
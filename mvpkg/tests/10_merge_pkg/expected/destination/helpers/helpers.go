@@ -0,0 +1,13 @@
+package helpers
+
+import (
+	"strings"
+)
+
+func Trim(s string) string {
+	return strings.TrimSpace(s)
+}
+
+func Shout(s string) string {
+	return Upper(Trim(s))
+}
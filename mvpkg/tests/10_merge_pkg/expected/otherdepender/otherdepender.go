@@ -0,0 +1,7 @@
+package otherdepender
+
+import "example.com/destination/helpers"
+
+func Depend() string {
+	return helpers.Upper("a")
+}
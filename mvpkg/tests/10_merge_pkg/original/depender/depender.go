@@ -0,0 +1,10 @@
+package depender
+
+import (
+	"example.com/destination/helpers"
+	u "example.com/source/util"
+)
+
+func Depend() string {
+	return u.Upper(helpers.Trim(" a "))
+}
@@ -0,0 +1,15 @@
+package helpers
+
+import (
+	"strings"
+
+	"example.com/source/util"
+)
+
+func Trim(s string) string {
+	return strings.TrimSpace(s)
+}
+
+func Shout(s string) string {
+	return util.Upper(Trim(s))
+}
@@ -0,0 +1,7 @@
+package otherdepender
+
+import "example.com/source/util"
+
+func Depend() string {
+	return util.Upper("a")
+}
@@ -0,0 +1,5 @@
+package helpers
+
+func Trim(s string) string {
+	return s
+}
@@ -0,0 +1,5 @@
+package util
+
+func Trim(s string) string {
+	return s
+}
@@ -0,0 +1,26 @@
+package depender
+
+import (
+	"fmt"
+
+	"example.com/destination/geometry"
+	"example.com/source/shapes"
+)
+
+// Largest returns the largest of the circles.
+func Largest(circles ...geometry.Circle) geometry.Circle {
+	largest := geometry.Circle{}
+	for _, c := range circles {
+		if c.Area() > largest.Area() {
+			largest = c
+		}
+	}
+
+	return largest
+}
+
+func Describe() {
+	c := Largest(geometry.Circle{Radius: 2})
+	s := shapes.Square{Side: 1}
+	fmt.Println(c.String(), c.Area(), s.Side)
+}
@@ -0,0 +1,23 @@
+package geometry
+
+import (
+	"fmt"
+	"math"
+
+	"example.com/source/shapes"
+)
+
+// Circle is a circle with a radius.
+type Circle struct {
+	Radius float64
+}
+
+// Area returns the area of the circle.
+func (c Circle) Area() float64 {
+	return math.Pi * c.Radius * c.Radius
+}
+
+// String describes the circle.
+func (c *Circle) String() string {
+	return fmt.Sprintf("circle of radius %f%s", c.Radius, shapes.Unit)
+}
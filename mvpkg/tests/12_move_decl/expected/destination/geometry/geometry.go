@@ -0,0 +1,8 @@
+package geometry
+
+// Shape is anything with an area.
+type Shape interface {
+	Area() float64
+}
+
+var _ Shape = Circle{}
@@ -0,0 +1,9 @@
+package shapes
+
+// Unit is the unit all lengths are measured in.
+const Unit = "cm"
+
+// Square is a square with a side.
+type Square struct {
+	Side float64
+}
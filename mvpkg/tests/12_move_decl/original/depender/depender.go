@@ -0,0 +1,25 @@
+package depender
+
+import (
+	"fmt"
+
+	"example.com/source/shapes"
+)
+
+// Largest returns the largest of the circles.
+func Largest(circles ...shapes.Circle) shapes.Circle {
+	largest := shapes.Circle{}
+	for _, c := range circles {
+		if c.Area() > largest.Area() {
+			largest = c
+		}
+	}
+
+	return largest
+}
+
+func Describe() {
+	c := Largest(shapes.Circle{Radius: 2})
+	s := shapes.Square{Side: 1}
+	fmt.Println(c.String(), c.Area(), s.Side)
+}
@@ -0,0 +1,10 @@
+package geometry
+
+import "example.com/source/shapes"
+
+// Shape is anything with an area.
+type Shape interface {
+	Area() float64
+}
+
+var _ Shape = shapes.Circle{}
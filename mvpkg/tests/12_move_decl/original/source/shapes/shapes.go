@@ -0,0 +1,29 @@
+package shapes
+
+import (
+	"fmt"
+	"math"
+)
+
+// Unit is the unit all lengths are measured in.
+const Unit = "cm"
+
+// Circle is a circle with a radius.
+type Circle struct {
+	Radius float64
+}
+
+// Area returns the area of the circle.
+func (c Circle) Area() float64 {
+	return math.Pi * c.Radius * c.Radius
+}
+
+// String describes the circle.
+func (c *Circle) String() string {
+	return fmt.Sprintf("circle of radius %f%s", c.Radius, Unit)
+}
+
+// Square is a square with a side.
+type Square struct {
+	Side float64
+}
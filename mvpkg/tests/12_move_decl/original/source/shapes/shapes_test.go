@@ -0,0 +1,13 @@
+package shapes_test
+
+import (
+	"testing"
+
+	"example.com/source/shapes"
+)
+
+func TestArea(t *testing.T) {
+	if (shapes.Circle{Radius: 1}).Area() == 0 {
+		t.Fatal("empty circle")
+	}
+}
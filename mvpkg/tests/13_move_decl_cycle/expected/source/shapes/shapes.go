@@ -0,0 +1,28 @@
+package shapes
+
+import "fmt"
+
+// Unit is the unit all lengths are measured in.
+const Unit = "cm"
+
+// Circle is a circle with a radius.
+type Circle struct {
+	Radius float64
+}
+
+// String describes the circle.
+func (c Circle) String() string {
+	return fmt.Sprintf("circle of radius %f%s", c.Radius, Unit)
+}
+
+// Largest returns the largest of the circles.
+func Largest(circles ...Circle) Circle {
+	largest := Circle{}
+	for _, c := range circles {
+		if c.Radius > largest.Radius {
+			largest = c
+		}
+	}
+
+	return largest
+}
@@ -0,0 +1,6 @@
+package geometry
+
+// Shape is anything with an area.
+type Shape interface {
+	Area() float64
+}
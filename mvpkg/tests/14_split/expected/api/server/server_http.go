@@ -0,0 +1,21 @@
+package server
+
+import (
+	"example.com/api"
+	"fmt"
+)
+
+// Server serves requests.
+type Server struct {
+	name string
+}
+
+// NewServer returns a new server.
+func NewServer(name string) *Server {
+	return &Server{name: name}
+}
+
+// Handle handles a request.
+func (s *Server) Handle(r api.Request) string {
+	return fmt.Sprintf("%s %s %s", s.name, api.Version, api.Normalize(r.Path))
+}
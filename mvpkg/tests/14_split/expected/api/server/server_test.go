@@ -0,0 +1,12 @@
+package server
+
+import (
+	"example.com/api"
+	"testing"
+)
+
+func TestHandle(t *testing.T) {
+	if NewServer("test").Handle(api.Request{}) != "test v1 /" {
+		t.Fatal("unexpected response")
+	}
+}
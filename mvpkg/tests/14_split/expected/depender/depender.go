@@ -0,0 +1,12 @@
+package depender
+
+import (
+	"example.com/api"
+	"example.com/api/server"
+)
+
+func Serve() string {
+	s := server.NewServer("depender")
+
+	return s.Handle(api.Request{Path: "/" + api.Version})
+}
@@ -0,0 +1,18 @@
+package api
+
+import "fmt"
+
+// Server serves requests.
+type Server struct {
+	name string
+}
+
+// NewServer returns a new server.
+func NewServer(name string) *Server {
+	return &Server{name: name}
+}
+
+// Handle handles a request.
+func (s *Server) Handle(r Request) string {
+	return fmt.Sprintf("%s %s %s", s.name, Version, normalize(r.Path))
+}
@@ -0,0 +1,17 @@
+package api
+
+// Version is the version of the API.
+const Version = "v1"
+
+// Request is a request to the API.
+type Request struct {
+	Path string
+}
+
+func normalize(path string) string {
+	if path == "" {
+		return "/"
+	}
+
+	return path
+}
@@ -0,0 +1,9 @@
+package api
+
+import "testing"
+
+func TestHandle(t *testing.T) {
+	if NewServer("test").Handle(Request{}) != "test v1 /" {
+		t.Fatal("unexpected response")
+	}
+}
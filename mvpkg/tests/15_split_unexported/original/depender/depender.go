@@ -0,0 +1,9 @@
+package depender
+
+import "example.com/api"
+
+func Serve() string {
+	s := api.NewServer("depender")
+
+	return s.Handle(api.Request{Path: "/" + api.Version})
+}
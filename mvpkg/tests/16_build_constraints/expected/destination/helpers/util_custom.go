@@ -0,0 +1,6 @@
+//go:build custom
+
+package helpers
+
+// Custom is only built with the custom tag.
+const Custom = true
@@ -0,0 +1,3 @@
+package helpers
+
+const name = "linux"
@@ -0,0 +1,6 @@
+package util
+
+// Name returns the name of the platform.
+func Name() string {
+	return name
+}
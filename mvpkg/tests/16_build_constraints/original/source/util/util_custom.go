@@ -0,0 +1,6 @@
+//go:build custom
+
+package util
+
+// Custom is only built with the custom tag.
+const Custom = true
@@ -0,0 +1,9 @@
+//go:build !windows
+
+package depender
+
+import "example.com/destination/helpers"
+
+func Hello() string {
+	return helpers.Greet("linux")
+}
@@ -0,0 +1,16 @@
+//go:build integration || e2e
+
+package depender
+
+import (
+	"testing"
+
+	"example.com/destination/helpers"
+)
+
+func TestGreet(t *testing.T) {
+	util := helpers.Greet("test")
+	if util == "" {
+		t.Fatal("empty greeting")
+	}
+}
@@ -0,0 +1,6 @@
+package helpers
+
+// Greet returns a greeting.
+func Greet(name string) string {
+	return "hello " + name
+}
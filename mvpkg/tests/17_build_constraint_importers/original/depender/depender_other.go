@@ -0,0 +1,9 @@
+//go:build !windows
+
+package depender
+
+import "example.com/source/util"
+
+func Hello() string {
+	return util.Greet("linux")
+}
@@ -0,0 +1,7 @@
+package depender
+
+import "example.com/source/util"
+
+func Hello() string {
+	return util.Greet("windows")
+}
@@ -0,0 +1,16 @@
+//go:build integration || e2e
+
+package depender
+
+import (
+	"testing"
+
+	"example.com/source/util"
+)
+
+func TestGreet(t *testing.T) {
+	util := util.Greet("test")
+	if util == "" {
+		t.Fatal("empty greeting")
+	}
+}
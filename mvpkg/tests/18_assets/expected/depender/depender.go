@@ -0,0 +1,7 @@
+package depender
+
+import "example.com/destination/helpers"
+
+func Version() string {
+	return helpers.Version
+}
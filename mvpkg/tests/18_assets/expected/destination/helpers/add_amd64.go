@@ -0,0 +1,4 @@
+package helpers
+
+// Add adds two numbers.
+func Add(a, b int64) int64
@@ -0,0 +1,8 @@
+//go:build !amd64
+
+package helpers
+
+// Add adds two numbers.
+func Add(a, b int64) int64 {
+	return a + b
+}
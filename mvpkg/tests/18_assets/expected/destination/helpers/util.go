@@ -0,0 +1,12 @@
+package helpers
+
+import (
+	"embed"
+	_ "embed"
+)
+
+//go:embed version.txt
+var Version string
+
+//go:embed static/*.txt
+var Static embed.FS
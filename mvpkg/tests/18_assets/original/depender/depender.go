@@ -0,0 +1,7 @@
+package depender
+
+import "example.com/source/util"
+
+func Version() string {
+	return util.Version
+}
@@ -0,0 +1,4 @@
+package util
+
+// Add adds two numbers.
+func Add(a, b int64) int64
@@ -0,0 +1,8 @@
+//go:build !amd64
+
+package util
+
+// Add adds two numbers.
+func Add(a, b int64) int64 {
+	return a + b
+}
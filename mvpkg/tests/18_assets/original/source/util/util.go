@@ -0,0 +1,12 @@
+package util
+
+import (
+	"embed"
+	_ "embed"
+)
+
+//go:embed version.txt
+var Version string
+
+//go:embed static/*.txt
+var Static embed.FS
@@ -0,0 +1,18 @@
+package util
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestAdd(t *testing.T) {
+	golden, err := os.ReadFile("testdata/golden/add.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if Add(1, 2) != 3 || strings.TrimSpace(string(golden)) != "golden" {
+		t.Fatal("unexpected result")
+	}
+}
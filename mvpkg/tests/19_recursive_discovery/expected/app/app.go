@@ -0,0 +1,13 @@
+package app
+
+import (
+	"fmt"
+
+	"example.com/destination/lib"
+	"example.com/destination/lib/sub"
+)
+
+// Print prints the greeting.
+func Print() {
+	fmt.Println(lib.Greeting(), sub.Name())
+}
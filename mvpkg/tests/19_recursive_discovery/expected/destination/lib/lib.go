@@ -0,0 +1,8 @@
+package lib
+
+import "example.com/destination/lib/sub"
+
+// Greeting returns a greeting.
+func Greeting() string {
+	return "hello " + sub.Name()
+}
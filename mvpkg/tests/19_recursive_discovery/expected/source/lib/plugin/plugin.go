@@ -0,0 +1,4 @@
+package plugin
+
+// Plugin is a separate module that stays where it is.
+const Plugin = "plugin"
@@ -0,0 +1,13 @@
+package app
+
+import (
+	"fmt"
+
+	"example.com/source/lib"
+	"example.com/source/lib/sub"
+)
+
+// Print prints the greeting.
+func Print() {
+	fmt.Println(lib.Greeting(), sub.Name())
+}
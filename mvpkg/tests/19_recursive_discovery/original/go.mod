@@ -0,0 +1,5 @@
+module "example.com" // quoted, with a comment
+
+go 1.25
+
+ignore node_modules
@@ -0,0 +1,6 @@
+package sub
+
+// Name returns a name.
+func Name() string {
+	return "world"
+}
@@ -0,0 +1,8 @@
+package depender
+
+import redis "example.com/destination/redisclient"
+
+// Connect returns a client for the default address.
+func Connect() *redis.Client {
+	return redis.NewClient(redis.DefaultAddr)
+}
@@ -0,0 +1,12 @@
+// Package redis is a client whose name differs from its directory.
+package redis // import "example.com/destination/redisclient"
+
+// Client talks to a server.
+type Client struct {
+	Addr string
+}
+
+// NewClient returns a client for addr.
+func NewClient(addr string) *Client {
+	return &Client{Addr: addr}
+}
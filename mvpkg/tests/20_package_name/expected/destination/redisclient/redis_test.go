@@ -0,0 +1,13 @@
+package redis_test
+
+import (
+	"testing"
+
+	redis "example.com/destination/redisclient"
+)
+
+func TestNewClient(t *testing.T) {
+	if redis.NewClient(redis.DefaultAddr).Addr != redis.DefaultAddr {
+		t.Fatal("wrong address")
+	}
+}
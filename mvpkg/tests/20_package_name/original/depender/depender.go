@@ -0,0 +1,8 @@
+package depender
+
+import "example.com/source/go-redis"
+
+// Connect returns a client for the default address.
+func Connect() *redis.Client {
+	return redis.NewClient(redis.DefaultAddr)
+}
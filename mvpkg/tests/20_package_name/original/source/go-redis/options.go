@@ -0,0 +1,4 @@
+package redis /* import "example.com/source/go-redis" */
+
+// DefaultAddr is the address used when none is given.
+const DefaultAddr = "localhost:6379"
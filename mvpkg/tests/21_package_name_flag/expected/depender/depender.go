@@ -0,0 +1,8 @@
+package depender
+
+import arith "example.com/destination/type"
+
+// Three returns three.
+func Three() int {
+	return arith.Add(1, 2)
+}
@@ -0,0 +1,8 @@
+package depender
+
+import "example.com/source/util"
+
+// Three returns three.
+func Three() int {
+	return util.Add(1, 2)
+}
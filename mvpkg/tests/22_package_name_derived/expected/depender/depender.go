@@ -0,0 +1,8 @@
+package depender
+
+import mylib "example.com/destination/my-lib/v3"
+
+// Three returns three.
+func Three() int {
+	return mylib.Add(1, 2)
+}
@@ -0,0 +1,6 @@
+package mylib
+
+// Add adds two numbers.
+func Add(a, b int) int {
+	return a + b
+}
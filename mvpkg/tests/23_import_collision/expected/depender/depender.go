@@ -0,0 +1,12 @@
+package depender
+
+import (
+	"log"
+
+	log2 "example.com/destination/log"
+)
+
+// Report logs an event.
+func Report(name string) {
+	log.Println(log2.Event(name))
+}
@@ -0,0 +1,8 @@
+package log
+
+import "fmt"
+
+// Event formats an event.
+func Event(name string) string {
+	return fmt.Sprintf("event: %s", name)
+}
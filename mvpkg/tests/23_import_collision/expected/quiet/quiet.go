@@ -0,0 +1,12 @@
+package quiet
+
+import (
+	stdlog "log"
+
+	"example.com/destination/log"
+)
+
+// Report logs an event.
+func Report(name string) {
+	stdlog.Println(log.Event(name))
+}
@@ -0,0 +1,12 @@
+package depender
+
+import (
+	"log"
+
+	"example.com/source/util"
+)
+
+// Report logs an event.
+func Report(name string) {
+	log.Println(util.Event(name))
+}
@@ -0,0 +1,12 @@
+package quiet
+
+import (
+	stdlog "log"
+
+	"example.com/source/util"
+)
+
+// Report logs an event.
+func Report(name string) {
+	stdlog.Println(util.Event(name))
+}
@@ -0,0 +1,13 @@
+package depender
+
+import helpers2 "example.com/destination/helpers"
+
+// Total adds up the helpers' scores.
+func Total(helpers []int) int {
+	return helpers2.Sum(helpers)
+}
+
+// Double adds up numbers twice.
+func Double(numbers []int) int {
+	return 2 * helpers2.Sum(numbers)
+}
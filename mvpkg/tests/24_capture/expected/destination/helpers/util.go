@@ -0,0 +1,11 @@
+package helpers
+
+// Sum adds up numbers.
+func Sum(numbers []int) int {
+	total := 0
+	for _, n := range numbers {
+		total += n
+	}
+
+	return total
+}
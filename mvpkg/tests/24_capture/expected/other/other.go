@@ -0,0 +1,8 @@
+package other
+
+import helpers2 "example.com/destination/helpers"
+
+// Score adds up the helpers.
+func Score() int {
+	return helpers2.Sum(helpers)
+}
@@ -0,0 +1,13 @@
+package depender
+
+import "example.com/source/util"
+
+// Total adds up the helpers' scores.
+func Total(helpers []int) int {
+	return util.Sum(helpers)
+}
+
+// Double adds up numbers twice.
+func Double(numbers []int) int {
+	return 2 * util.Sum(numbers)
+}
@@ -0,0 +1,3 @@
+package other
+
+var helpers = []int{1, 2, 3}
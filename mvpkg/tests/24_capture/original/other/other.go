@@ -0,0 +1,8 @@
+package other
+
+import "example.com/source/util"
+
+// Score adds up the helpers.
+func Score() int {
+	return util.Sum(helpers)
+}
@@ -0,0 +1,8 @@
+package mirrored
+
+import util "example.com/destination/helpers"
+
+// Three returns three.
+func Three() int {
+	return util.Sum(1, 2)
+}
@@ -0,0 +1,8 @@
+package redundant
+
+import helpers "example.com/destination/helpers"
+
+// Three returns three.
+func Three() int {
+	return helpers.Sum(1, 2)
+}
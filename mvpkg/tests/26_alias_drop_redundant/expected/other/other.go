@@ -0,0 +1,8 @@
+package other
+
+import u "example.com/destination/helpers"
+
+// Three returns three.
+func Three() int {
+	return u.Sum(1, 2)
+}
@@ -0,0 +1,8 @@
+package plain
+
+import "example.com/source/util"
+
+// Three returns three.
+func Three() int {
+	return util.Sum(1, 2)
+}
@@ -0,0 +1,11 @@
+package helpers
+
+// Pair holds two numbers.
+type Pair struct {
+	A, B int
+}
+
+// Sum adds up a pair.
+func Sum(p Pair) int {
+	return p.A + p.B
+}
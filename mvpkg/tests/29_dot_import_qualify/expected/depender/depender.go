@@ -0,0 +1,13 @@
+package depender
+
+import (
+	"example.com/destination/helpers"
+	. "strings"
+)
+
+// Three returns three.
+func Three() int {
+	p := helpers.Pair{A: 1, B: 2}
+
+	return helpers.Sum(p) + len(TrimSpace(" "))
+}
@@ -0,0 +1,13 @@
+package depender
+
+import (
+	. "example.com/source/util"
+	. "strings"
+)
+
+// Three returns three.
+func Three() int {
+	p := Pair{A: 1, B: 2}
+
+	return Sum(p) + len(TrimSpace(" "))
+}
@@ -0,0 +1,10 @@
+package extra
+
+// Min returns the smaller number.
+func Min(a, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
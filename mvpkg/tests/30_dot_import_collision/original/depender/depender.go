@@ -0,0 +1,8 @@
+package depender
+
+import . "example.com/source/extra"
+
+// Max returns the larger number.
+func Max(a, b int) int {
+	return -Min(-a, -b)
+}
@@ -0,0 +1,10 @@
+package base
+
+// Max returns the larger number.
+func Max(a, b int) int {
+	if a > b {
+		return a
+	}
+
+	return b
+}
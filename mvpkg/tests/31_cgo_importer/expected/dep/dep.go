@@ -0,0 +1,11 @@
+package dep
+
+// #include <stdlib.h>
+import "C"
+
+import "example.com/destination/util"
+
+// Abs returns the absolute value of n, doubled.
+func Abs(n int) int {
+	return util.Double(int(C.abs(C.int(n))))
+}
@@ -0,0 +1,6 @@
+package util
+
+// Double doubles n.
+func Double(n int) int {
+	return n * 2
+}
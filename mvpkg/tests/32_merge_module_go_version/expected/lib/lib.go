@@ -0,0 +1,11 @@
+package lib
+
+// Sum returns the sum of the numbers up to n.
+func Sum(n int) int {
+	total := 0
+	for i := range n {
+		total += i
+	}
+
+	return total
+}
@@ -0,0 +1,5 @@
+module example.org/lib
+
+go 1.22
+
+toolchain go1.22.3
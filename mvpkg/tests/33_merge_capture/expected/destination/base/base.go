@@ -0,0 +1,10 @@
+package base
+
+import "example.com/source/util"
+
+// Compute returns three.
+func Compute() int {
+	Helper := 2
+
+	return Helper + util.Helper()
+}
@@ -0,0 +1,6 @@
+package util
+
+// Helper returns one.
+func Helper() int {
+	return 1
+}
@@ -0,0 +1,10 @@
+package depender
+
+import (
+	geometry2 "example.com/destination/geometry"
+)
+
+// Scale returns a circle of the given radius.
+func Scale(geometry float64) geometry2.Circle {
+	return geometry2.Circle{R: geometry}
+}
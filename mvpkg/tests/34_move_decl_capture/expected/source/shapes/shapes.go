@@ -0,0 +1,10 @@
+package shapes
+
+import geometry2 "example.com/destination/geometry"
+
+// Unit returns a circle with a radius of one.
+func Unit() geometry2.Circle {
+	geometry := 1.0
+
+	return geometry2.Circle{R: geometry}
+}
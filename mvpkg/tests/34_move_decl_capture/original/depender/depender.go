@@ -0,0 +1,8 @@
+package depender
+
+import "example.com/source/shapes"
+
+// Scale returns a circle of the given radius.
+func Scale(geometry float64) shapes.Circle {
+	return shapes.Circle{R: geometry}
+}
@@ -0,0 +1,13 @@
+package shapes
+
+// Circle is a circle with a radius.
+type Circle struct {
+	R float64
+}
+
+// Unit returns a circle with a radius of one.
+func Unit() Circle {
+	geometry := 1.0
+
+	return Circle{R: geometry}
+}
@@ -0,0 +1,8 @@
+package util
+
+//go:generate go run gen.go
+
+// Helper returns a generated value.
+func Helper() int {
+	return generated
+}
@@ -0,0 +1,9 @@
+//go:build ignore
+
+package main
+
+import "os"
+
+func main() {
+	os.WriteFile("generated.go", []byte("package util\n\nconst generated = 1\n"), 0o644)
+}
@@ -0,0 +1,3 @@
+package util
+
+const generated = 1
@@ -0,0 +1,8 @@
+package dep
+
+import "example.com/source/shapes"
+
+// Area returns the area of the square.
+func Area(s shapes.Square) float64 {
+	return s.Side * s.Side
+}
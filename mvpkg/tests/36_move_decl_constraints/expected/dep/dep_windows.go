@@ -0,0 +1,8 @@
+package dep
+
+import (
+	"example.com/destination/geometry"
+)
+
+// Default is the circle used on Windows.
+var Default = geometry.Circle{R: 2}
@@ -0,0 +1,6 @@
+package geometry
+
+// Circle is a circle with a radius.
+type Circle struct {
+	R float64
+}
@@ -0,0 +1,6 @@
+package shapes
+
+// Square is a square with a side.
+type Square struct {
+	Side float64
+}
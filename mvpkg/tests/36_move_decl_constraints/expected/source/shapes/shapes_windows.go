@@ -0,0 +1,8 @@
+package shapes
+
+import "example.com/destination/geometry"
+
+// Unit returns a circle with a radius of one.
+func Unit() geometry.Circle {
+	return geometry.Circle{R: 1}
+}
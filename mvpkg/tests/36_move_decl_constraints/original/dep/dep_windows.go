@@ -0,0 +1,6 @@
+package dep
+
+import "example.com/source/shapes"
+
+// Default is the circle used on Windows.
+var Default = shapes.Circle{R: 2}
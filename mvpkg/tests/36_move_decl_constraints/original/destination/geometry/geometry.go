@@ -0,0 +1,4 @@
+package geometry
+
+// Pi is the ratio of the circumference of a circle to its diameter.
+const Pi = 3.14159
@@ -0,0 +1,11 @@
+package shapes
+
+// Circle is a circle with a radius.
+type Circle struct {
+	R float64
+}
+
+// Square is a square with a side.
+type Square struct {
+	Side float64
+}
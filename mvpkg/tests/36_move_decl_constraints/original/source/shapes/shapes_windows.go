@@ -0,0 +1,6 @@
+package shapes
+
+// Unit returns a circle with a radius of one.
+func Unit() Circle {
+	return Circle{R: 1}
+}
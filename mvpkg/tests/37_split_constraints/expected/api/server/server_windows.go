@@ -0,0 +1,8 @@
+package server
+
+import "example.com/api"
+
+// Handle handles a request on Windows.
+func (s *Server) Handle(path string) string {
+	return s.name + " " + api.Version + " " + api.Normalize(path)
+}
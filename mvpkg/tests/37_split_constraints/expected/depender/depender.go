@@ -0,0 +1,8 @@
+package depender
+
+import "example.com/api"
+
+// Version returns the version of the API.
+func Version() string {
+	return api.Version
+}
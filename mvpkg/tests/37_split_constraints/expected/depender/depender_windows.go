@@ -0,0 +1,10 @@
+package depender
+
+import (
+	"example.com/api/server"
+)
+
+// Serve serves a request on Windows.
+func Serve() string {
+	return server.NewServer("depender").Handle("/")
+}
@@ -0,0 +1,12 @@
+package api
+
+// Version is the version of the API.
+const Version = "v1"
+
+func normalize(path string) string {
+	if path == "" {
+		return "/"
+	}
+
+	return path
+}
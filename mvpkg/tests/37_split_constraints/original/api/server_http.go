@@ -0,0 +1,11 @@
+package api
+
+// Server serves requests.
+type Server struct {
+	name string
+}
+
+// NewServer returns a new server.
+func NewServer(name string) *Server {
+	return &Server{name: name}
+}
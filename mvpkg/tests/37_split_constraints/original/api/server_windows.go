@@ -0,0 +1,6 @@
+package api
+
+// Handle handles a request on Windows.
+func (s *Server) Handle(path string) string {
+	return s.name + " " + Version + " " + normalize(path)
+}
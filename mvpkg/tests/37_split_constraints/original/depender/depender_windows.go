@@ -0,0 +1,8 @@
+package depender
+
+import "example.com/api"
+
+// Serve serves a request on Windows.
+func Serve() string {
+	return api.NewServer("depender").Handle("/")
+}
@@ -0,0 +1,238 @@
+package mvpkg
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Errors returned by Undo.
+var (
+	ErrNoGitDir    = fmt.Errorf("couldn't find .git directory")
+	ErrNoJournal   = fmt.Errorf("no move to undo")
+	ErrTreeChanged = fmt.Errorf("files changed since the last move")
+)
+
+// journalFile is the on-disk form of a journal. All paths are relative to the root of the repository.
+type journalFile struct {
+	Entries []journalEntry `json:"entries"`
+	// Hashes holds the sha256 of every file touched by the move, as the move left it
+	Hashes map[string]string `json:"hashes"`
+}
+
+// journalPath returns the path of the persisted journal and the root of the repository it belongs to.
+func journalPath(dir string) (string, string, error) {
+	gitDir, root, err := findGitDir(dir)
+	if err != nil {
+		return "", "", err
+	}
+
+	return filepath.Join(gitDir, "mvpkg", "journal.json"), root, nil
+}
+
+// save persists the journal so that the move can be undone later.
+func (j *journal) save(filename, root string) error {
+	jf := journalFile{Hashes: map[string]string{}}
+	finalFiles := map[string]struct{}{}
+
+	for _, e := range j.entries {
+		switch e.Op {
+		case opWrite:
+			finalFiles[e.Path] = struct{}{}
+		case opRename:
+			delete(finalFiles, e.Path)
+			finalFiles[e.NewPath] = struct{}{}
+		case opRemove:
+			delete(finalFiles, e.Path)
+		case opMkdir, opRmdir:
+		}
+
+		rel, err := e.relativeTo(root)
+		if err != nil {
+			return err
+		}
+
+		jf.Entries = append(jf.Entries, rel)
+	}
+
+	for finalFile := range finalFiles {
+		hash, err := hashFile(finalFile)
+		if err != nil {
+			return err
+		}
+
+		rel, err := relativePath(root, finalFile)
+		if err != nil {
+			return err
+		}
+
+		jf.Hashes[rel] = hash
+	}
+
+	data, err := json.Marshal(jf)
+	if err != nil {
+		return fmt.Errorf("failed to encode journal: %w", err)
+	}
+
+	err = os.MkdirAll(filepath.Dir(filename), 0o755)
+	if err != nil {
+		return fmt.Errorf("failed to create journal directory: %w", err)
+	}
+
+	err = ioutil.WriteFile(filename, data, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to write journal %s: %w", filename, err)
+	}
+
+	return nil
+}
+
+// loadJournal reads a persisted journal and checks that the files it touched haven't changed since it was written.
+func loadJournal(filename, root string) (*journal, error) {
+	data, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil, ErrNoJournal
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read journal %s: %w", filename, err)
+	}
+
+	jf := journalFile{}
+
+	err = json.Unmarshal(data, &jf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode journal %s: %w", filename, err)
+	}
+
+	j := &journal{}
+	for _, e := range jf.Entries {
+		j.entries = append(j.entries, e.absoluteFrom(root))
+	}
+
+	changed := []string{}
+
+	for rel, hash := range jf.Hashes {
+		current, hashErr := hashFile(filepath.Join(root, filepath.FromSlash(rel)))
+		if hashErr != nil || current != hash {
+			changed = append(changed, rel)
+		}
+	}
+
+	for _, e := range jf.Entries {
+		if e.Op != opRename && e.Op != opRemove {
+			continue
+		}
+
+		// the move left nothing at the source of a rename or at a removed file, so anything there now would be overwritten
+		if _, ok := jf.Hashes[e.Path]; ok {
+			continue
+		}
+
+		if _, statErr := os.Stat(filepath.Join(root, filepath.FromSlash(e.Path))); statErr == nil {
+			changed = append(changed, e.Path)
+		}
+	}
+
+	if len(changed) > 0 {
+		sort.Strings(changed)
+
+		return nil, fmt.Errorf("%w: %v", ErrTreeChanged, changed)
+	}
+
+	return j, nil
+}
+
+func (e journalEntry) relativeTo(root string) (journalEntry, error) {
+	var err error
+
+	e.Path, err = relativePath(root, e.Path)
+	if err != nil {
+		return e, err
+	}
+
+	if e.NewPath != "" {
+		e.NewPath, err = relativePath(root, e.NewPath)
+	}
+
+	return e, err
+}
+
+func (e journalEntry) absoluteFrom(root string) journalEntry {
+	e.Path = filepath.Join(root, filepath.FromSlash(e.Path))
+	if e.NewPath != "" {
+		e.NewPath = filepath.Join(root, filepath.FromSlash(e.NewPath))
+	}
+
+	return e
+}
+
+func relativePath(root, filePath string) (string, error) {
+	rel, err := filepath.Rel(root, filePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to make %s relative to %s: %w", filePath, root, err)
+	}
+
+	return filepath.ToSlash(rel), nil
+}
+
+func hashFile(filename string) (string, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", filename, err)
+	}
+
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Undo restores the files changed by the last move in the repository containing pwd.
+// It refuses to do anything if any of those files have changed since the move. Once started, undoing isn't
+// interrupted by ctx, that would leave the tree partially moved. logger is optional.
+func Undo(ctx context.Context, pwd string, logger Logger) error {
+	printf := Options{Logger: logger}.printf()
+	start := time.Now()
+
+	defer func() {
+		printf("done in %s\n", time.Since(start))
+	}()
+
+	filename, root, err := journalPath(pwd)
+	if err != nil {
+		return err
+	}
+
+	printf("Loading journal %s\n", filename)
+
+	j, err := loadJournal(filename, root)
+	if err != nil {
+		return fmt.Errorf("failed to load journal: %w", err)
+	}
+
+	err = ctx.Err()
+	if err != nil {
+		return err
+	}
+
+	printf("Undoing %d changes\n", len(j.entries))
+
+	err = j.rollback()
+	if err != nil {
+		return fmt.Errorf("failed to undo move: %w", err)
+	}
+
+	err = os.Remove(filename)
+	if err != nil {
+		return fmt.Errorf("failed to remove journal %s: %w", filename, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,126 @@
+package mvpkg
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+)
+
+// goModuleNameAndPath returns the module path and the directory of the go module containing dir, found by looking for
+// a go.mod file in dir and its parents. It returns ErrNoGoMod if there is none.
+func goModuleNameAndPath(dir string) (string, string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to make %s absolute: %w", dir, err)
+	}
+
+	modDir := filepath.ToSlash(dir)
+
+	for {
+		filename := filepath.Join(modDir, "go.mod")
+
+		data, err := ioutil.ReadFile(filename)
+		if err == nil {
+			// found it, stop searching
+			modFile, err := modfile.ParseLax(filename, data, nil)
+			if err != nil {
+				return "", "", fmt.Errorf("failed to parse %s: %w", filename, err)
+			}
+
+			if modFile.Module == nil || modFile.Module.Mod.Path == "" {
+				return "", "", fmt.Errorf("%w: %s", ErrNoModulePath, filename)
+			}
+
+			return modFile.Module.Mod.Path, modDir, nil
+		}
+
+		if !os.IsNotExist(err) {
+			return "", "", fmt.Errorf("failed to read %s: %w", filename, err)
+		}
+
+		parentDir := filepath.Dir(modDir)
+		if parentDir == modDir {
+			// walked all the way to the root and didn't find anything
+			return "", "", ErrNoGoMod
+		}
+
+		modDir = parentDir
+	}
+}
+
+// goWorkPath returns the path of the go.work file used by the go command for modules in dir.
+// If workspace mode is disabled or there is no go.work file in the directory tree, it returns false.
+func goWorkPath(dir string) (string, bool, error) {
+	switch gowork := os.Getenv("GOWORK"); gowork {
+	case "off":
+		return "", false, nil
+	case "":
+	default:
+		return gowork, true, nil
+	}
+
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to make %s absolute: %w", dir, err)
+	}
+
+	dir = absDir
+
+	for {
+		workFile := filepath.Join(dir, "go.work")
+		if _, err := os.Stat(workFile); err == nil {
+			return workFile, true, nil
+		}
+
+		parentDir := filepath.Dir(dir)
+		if parentDir == dir {
+			return "", false, nil
+		}
+
+		dir = parentDir
+	}
+}
+
+// findGitDir returns the git directory of the repository containing dir and the root of its working tree.
+// If dir is not in a git repository, it returns ErrNoGitDir.
+func findGitDir(dir string) (string, string, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to make %s absolute: %w", dir, err)
+	}
+
+	dir = absDir
+
+	for {
+		dotGit := filepath.Join(dir, ".git")
+
+		info, err := os.Stat(dotGit)
+		if err == nil {
+			if info.IsDir() {
+				return dotGit, dir, nil
+			}
+
+			// worktrees and submodules have a .git file pointing at the real git directory
+			f, err := ioutil.ReadFile(dotGit)
+			if err == nil && strings.HasPrefix(string(f), "gitdir: ") {
+				gitDir := strings.TrimSpace(strings.TrimPrefix(string(f), "gitdir: "))
+				if !filepath.IsAbs(gitDir) {
+					gitDir = filepath.Join(dir, gitDir)
+				}
+
+				return gitDir, dir, nil
+			}
+		}
+
+		parentDir := filepath.Dir(dir)
+		if parentDir == dir {
+			return "", "", ErrNoGitDir
+		}
+
+		dir = parentDir
+	}
+}